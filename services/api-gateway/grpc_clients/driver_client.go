@@ -2,6 +2,7 @@ package grpc_clients
 
 import (
 	"os"
+	"ride-sharing/shared/auth"
 	pb "ride-sharing/shared/proto/driver"
 	"ride-sharing/shared/tracing"
 
@@ -20,10 +21,12 @@ func NewDriverServiceClient() (*driverServiceClient, error) {
 		driverServiceURL = "driver-service:9092"
 	}
 
+	// The identity of the request is passed along, the service checks the user owns what it asks for
 	dialOptions := append(
 		tracing.DialOptionsWithTracing(),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
+	dialOptions = append(dialOptions, auth.DialOptionsWithIdentity()...)
 
 	conn, err := grpc.NewClient(driverServiceURL, dialOptions...)
 	if err != nil {
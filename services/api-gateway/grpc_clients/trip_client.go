@@ -2,6 +2,7 @@ package grpc_clients
 
 import (
 	"os"
+	"ride-sharing/shared/auth"
 	pb "ride-sharing/shared/proto/trip"
 	"ride-sharing/shared/tracing"
 
@@ -20,10 +21,12 @@ func NewTripServiceClient() (*tripServiceClient, error) {
 		tripServiceURL = "trip-service:9093"
 	}
 
+	// The identity of the request is passed along, the service checks the user owns what it asks for
 	dialOptions := append(
 		tracing.DialOptionsWithTracing(),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
+	dialOptions = append(dialOptions, auth.DialOptionsWithIdentity()...)
 
 	conn, err := grpc.NewClient(tripServiceURL, dialOptions...)
 	if err != nil {
@@ -6,17 +6,25 @@ import (
 	"log"
 	"net/http"
 	"ride-sharing/services/api-gateway/grpc_clients"
+	"ride-sharing/shared/auth"
 	"ride-sharing/shared/contracts"
 	"ride-sharing/shared/env"
 	"ride-sharing/shared/messaging"
+	pb "ride-sharing/shared/proto/trip"
 	"ride-sharing/shared/tracing"
+	"strconv"
 
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/webhook"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var tracer = tracing.GetTracer("api-gateway")
 
+const maxIdempotencyKeyLength = 255
+
 func handleTripStart(w http.ResponseWriter, r *http.Request) {
 	ctx, span := tracer.Start(r.Context(), "handleTripStart")
 	defer span.End()
@@ -40,10 +48,24 @@ func handleTripStart(w http.ResponseWriter, r *http.Request) {
 	// Don't forget to close the client to avoid resource leaks!
 	defer tripService.Close()
 
-	trip, err := tripService.Client.CreateTrip(ctx, reqBody.toProto())
+	// Retries of the same request must send the same key, so they don't create a second trip
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+
+	trip, err := tripService.Client.CreateTrip(ctx, reqBody.toProto(auth.FromContext(ctx).UserID, idempotencyKey))
 	if err != nil {
 		log.Printf("Failed to start a trip: %v", err)
-		http.Error(w, "Failed to start trip", http.StatusInternalServerError)
+
+		// Tell the rider to preview the trip again when the fare can't be booked anymore
+		if fareErr, ok := fareErrors[grpcErrorReason(err)]; ok {
+			writeJSON(w, fareErr.status, contracts.APIResponse{Error: fareErr.apiError})
+			return
+		}
+
+		http.Error(w, "Failed to start trip", httpStatusFromGRPC(err))
 		return
 	}
 
@@ -52,11 +74,11 @@ func handleTripStart(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, response)
 }
 
-func handleTripPreview(w http.ResponseWriter, r *http.Request) {
-	ctx, span := tracer.Start(r.Context(), "handleTripPreview")
+func handleTripCancel(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "handleTripCancel")
 	defer span.End()
 
-	var reqBody previewTripRequest
+	var reqBody cancelTripRequest
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
 		http.Error(w, "failed to parse JSON data", http.StatusBadRequest)
 		return
@@ -64,11 +86,115 @@ func handleTripPreview(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	// validation
-	if reqBody.UserID == "" {
-		http.Error(w, "user ID is required", http.StatusBadRequest)
+	tripService, err := grpc_clients.NewTripServiceClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer tripService.Close()
+
+	resp, err := tripService.Client.CancelTrip(ctx, reqBody.toProto(r.PathValue("id"), auth.FromContext(ctx).UserID))
+	if err != nil {
+		log.Printf("Failed to cancel the trip: %v", err)
+		http.Error(w, "Failed to cancel trip", httpStatusFromGRPC(err))
+		return
+	}
+
+	response := contracts.APIResponse{Data: resp.Trip}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func handleGetTrip(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "handleGetTrip")
+	defer span.End()
+
+	tripService, err := grpc_clients.NewTripServiceClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer tripService.Close()
+
+	resp, err := tripService.Client.GetTrip(ctx, &pb.GetTripRequest{TripID: r.PathValue("id")})
+	if err != nil {
+		log.Printf("Failed to get the trip: %v", err)
+		http.Error(w, "Failed to get trip", httpStatusFromGRPC(err))
+		return
+	}
+
+	response := contracts.APIResponse{Data: resp.Trip}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleListUserTrips lists the trips of a rider, or of a driver with ?role=driver. Users list their own trips,
+// admins anyone's. Results can be filtered with one or more ?status= and paged with ?pageSize= and ?cursor=.
+func handleListUserTrips(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "handleListUserTrips")
+	defer span.End()
+
+	query := r.URL.Query()
+
+	pageSize := 0
+	if v := query.Get("pageSize"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			http.Error(w, "invalid page size", http.StatusBadRequest)
+			return
+		}
+		pageSize = size
+	}
+
+	tripService, err := grpc_clients.NewTripServiceClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer tripService.Close()
+
+	var resp *pb.ListTripsResponse
+	switch query.Get("role") {
+	case "", "rider":
+		resp, err = tripService.Client.ListTripsByUser(ctx, &pb.ListTripsByUserRequest{
+			UserID:   r.PathValue("id"),
+			Statuses: query["status"],
+			PageSize: int32(pageSize),
+			Cursor:   query.Get("cursor"),
+		})
+	case "driver":
+		resp, err = tripService.Client.ListTripsByDriver(ctx, &pb.ListTripsByDriverRequest{
+			DriverID: r.PathValue("id"),
+			Statuses: query["status"],
+			PageSize: int32(pageSize),
+			Cursor:   query.Get("cursor"),
+		})
+	default:
+		http.Error(w, "role must be rider or driver", http.StatusBadRequest)
 		return
 	}
+	if err != nil {
+		log.Printf("Failed to list the trips: %v", err)
+		http.Error(w, "Failed to list trips", httpStatusFromGRPC(err))
+		return
+	}
+
+	response := contracts.APIResponse{Data: resp}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func handleTripPreview(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "handleTripPreview")
+	defer span.End()
+
+	var reqBody previewTripRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "failed to parse JSON data", http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
 
 	// Why we need to create a new client for each connection:
 	// because if a service is down, we don't want to block the whole application
@@ -81,7 +207,7 @@ func handleTripPreview(w http.ResponseWriter, r *http.Request) {
 	// Don't forget to close the client to avoid resource leaks!
 	defer tripService.Close()
 
-	tripPreview, err := tripService.Client.PreviewTrip(ctx, reqBody.toProto())
+	tripPreview, err := tripService.Client.PreviewTrip(ctx, reqBody.toProto(auth.FromContext(ctx).UserID))
 	if err != nil {
 		log.Printf("Failed to preview a trip: %v", err)
 		http.Error(w, "Failed to preview trip", http.StatusInternalServerError)
@@ -143,26 +269,62 @@ func handleStripeWebhook(w http.ResponseWriter, r *http.Request, rb *messaging.R
 			DriverID: session.Metadata["driver_id"],
 		}
 
-		payloadBytes, err := json.Marshal(payload)
-		if err != nil {
-			log.Printf("Error marshalling payload: %v", err)
-			http.Error(w, "Failed to marshal payload", http.StatusInternalServerError)
+		// Stripe sends the event again until it gets a 2xx, its ID lets the trip service skip the copies
+		if err := messaging.PublishWithID(ctx, rb, "stripe-"+event.ID, contracts.PaymentEventSuccess, session.Metadata["user_id"], payload); err != nil {
+			log.Printf("Error publishing payment event: %v", err)
+			http.Error(w, "Failed to publish payment event", http.StatusInternalServerError)
 			return
 		}
+	}
+}
 
-		message := contracts.AmqpMessage{
-			OwnerID: session.Metadata["user_id"],
-			Data:    payloadBytes,
-		}
+type fareError struct {
+	status   int
+	apiError *contracts.APIError
+}
 
-		if err := rb.PublishMessage(
-			ctx,
-			contracts.PaymentEventSuccess,
-			message,
-		); err != nil {
-			log.Printf("Error publishing payment event: %v", err)
-			http.Error(w, "Failed to publish payment event", http.StatusInternalServerError)
-			return
+// fareErrors are the responses to the fares the trip service refused, by reason
+var fareErrors = map[string]fareError{
+	"FARE_EXPIRED": {
+		status: http.StatusGone,
+		apiError: &contracts.APIError{
+			Code:    "fare_expired",
+			Message: "The fare has expired, preview the trip again to get a new one",
+		},
+	},
+	"FARE_ALREADY_USED": {
+		status: http.StatusConflict,
+		apiError: &contracts.APIError{
+			Code:    "fare_already_used",
+			Message: "The fare was already used to request a trip",
+		},
+	},
+}
+
+// grpcErrorReason returns the reason attached to a gRPC error, if any
+func grpcErrorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
 		}
 	}
+	return ""
+}
+
+// httpStatusFromGRPC maps the gRPC status of a failed call to the closest HTTP status
+func httpStatusFromGRPC(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.FailedPrecondition:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
 }
@@ -9,6 +9,8 @@ import (
 	"syscall"
 	"time"
 
+	"ride-sharing/shared/auth"
+	"ride-sharing/shared/db"
 	"ride-sharing/shared/env"
 	"ride-sharing/shared/messaging"
 	"ride-sharing/shared/tracing"
@@ -40,7 +42,21 @@ func main() {
 
 	mux := http.NewServeMux()
 
+	// The users are authenticated with JWTs signed with the HS256 secret or one of the RS256 keys of the JWKS file
+	verifierCfg := auth.DefaultVerifierConfig()
+	verifierCfg.HS256Secret = env.GetString("JWT_HS256_SECRET", "")
+	verifierCfg.JWKSFile = env.GetString("JWT_JWKS_FILE", "")
+	verifierCfg.Issuer = env.GetString("JWT_ISSUER", "")
+	verifierCfg.Audience = env.GetString("JWT_AUDIENCE", "")
+	verifierCfg.Leeway = time.Duration(env.GetInt("JWT_LEEWAY_SECONDS", 30)) * time.Second
+
+	verifier, err := auth.NewVerifier(verifierCfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize the JWT verifier: %v", err)
+	}
+
 	// RabbitMQ connection
+	messaging.Producer = "api-gateway"
 	rabbitmq, err := messaging.NewRabbitMQ(rabbitMqURI)
 	if err != nil {
 		log.Fatal(err)
@@ -49,14 +65,68 @@ func main() {
 
 	log.Println("Starting RabbitMQ connection")
 
-	mux.Handle("POST /trip/preview", tracing.WrapHandlerFunc(enableCORS(handleTripPreview), "/trip/preview"))
-	mux.Handle("POST /trip/start", tracing.WrapHandlerFunc(enableCORS(handleTripStart), "/trip/start"))
-	mux.Handle("/ws/drivers", tracing.WrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// The notifications of the offline users wait in their mailbox until they reconnect
+	mailboxCfg := messaging.DefaultMailboxConfig()
+	mailboxCfg.MaxMessages = env.GetInt("MAILBOX_MAX_MESSAGES", mailboxCfg.MaxMessages)
+	mailboxCfg.TTL = time.Duration(env.GetInt("MAILBOX_TTL_MINUTES", 15)) * time.Minute
+
+	// With MongoDB, the instances share which one holds each connection and the mailboxes, so the gateway
+	// can be scaled out
+	if mongoCfg := db.NewMongoDefaultConfig(); mongoCfg.URI != "" {
+		mongoClient, err := db.NewMongoClient(ctx, mongoCfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize MongoDB, err: %v", err)
+		}
+		defer mongoClient.Disconnect(ctx)
+
+		mongoDb := db.GetDatabase(mongoClient, mongoCfg)
+
+		mailbox := messaging.NewMongoMailboxStore(mongoDb, mailboxCfg)
+		if err := mailbox.EnsureIndexes(ctx); err != nil {
+			log.Fatalf("Failed to create the mailbox indexes: %v", err)
+		}
+		connManager.UseMailbox(mailbox)
+
+		presenceStore := messaging.NewMongoPresenceStore(mongoDb)
+		if err := presenceStore.EnsureIndexes(ctx); err != nil {
+			log.Fatalf("Failed to create the presence indexes: %v", err)
+		}
+
+		instanceID := env.GetString("GATEWAY_INSTANCE_ID", hostname())
+		if err := connManager.EnablePresence(ctx, rabbitmq, presenceStore, instanceID); err != nil {
+			log.Fatalf("Failed to enable the presence: %v", err)
+		}
+
+		log.Printf("Sharing the WebSocket connections as instance %s", instanceID)
+	} else {
+		connManager.UseMailbox(messaging.NewMemoryMailboxStore(mailboxCfg))
+	}
+
+	if err := startNotifications(rabbitmq); err != nil {
+		log.Fatalf("Failed to start the WebSocket notifications: %v", err)
+	}
+
+	// Not ready while the RabbitMQ connection is down: the WebSocket notifications can't be delivered
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !rabbitmq.Ready() {
+			http.Error(w, "rabbitmq unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// The user ID comes from the token: riders book and cancel their trips, drivers cancel theirs,
+	// the trip service checks who may read a trip
+	mux.Handle("POST /trip/preview", tracing.WrapHandlerFunc(enableCORS(requireAuth(verifier, handleTripPreview, auth.RoleRider)), "/trip/preview"))
+	mux.Handle("POST /trip/start", tracing.WrapHandlerFunc(enableCORS(requireAuth(verifier, handleTripStart, auth.RoleRider)), "/trip/start"))
+	mux.Handle("GET /trips/{id}", tracing.WrapHandlerFunc(enableCORS(requireAuth(verifier, handleGetTrip, auth.RoleRider, auth.RoleDriver, auth.RoleAdmin)), "/trips/{id}"))
+	mux.Handle("GET /users/{id}/trips", tracing.WrapHandlerFunc(enableCORS(requireAuth(verifier, handleListUserTrips, auth.RoleRider, auth.RoleDriver, auth.RoleAdmin)), "/users/{id}/trips"))
+	mux.Handle("POST /trip/{id}/cancel", tracing.WrapHandlerFunc(enableCORS(requireAuth(verifier, handleTripCancel, auth.RoleRider, auth.RoleDriver)), "/trip/{id}/cancel"))
+	// Authenticated before the tracing, so the token of their URL is not recorded
+	mux.Handle("/ws/drivers", requireAuth(verifier, tracing.WrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleDriversWebSocket(w, r, rabbitmq)
-	}, "/ws/drivers"))
-	mux.Handle("/ws/riders", tracing.WrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handleRidersWebSocket(w, r, rabbitmq)
-	}, "/ws/riders"))
+	}, "/ws/drivers").ServeHTTP, auth.RoleDriver))
+	mux.Handle("/ws/riders", requireAuth(verifier, tracing.WrapHandlerFunc(handleRidersWebSocket, "/ws/riders").ServeHTTP, auth.RoleRider))
 	mux.Handle("/webhook/stripe", tracing.WrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleStripeWebhook(w, r, rabbitmq)
 	}, "/webhook/stripe"))
@@ -92,3 +162,12 @@ func main() {
 		}
 	}
 }
+
+// hostname is the pod name on Kubernetes, unique among the gateway replicas
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Failed to read the hostname: %v", err)
+	}
+	return name
+}
@@ -1,12 +1,21 @@
 package main
 
-import "net/http"
+import (
+	"errors"
+	"log"
+	"net/http"
+	"ride-sharing/shared/auth"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
 
 func enableCORS(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 
 		// allow preflight requests from the browser API
 		if r.Method == "OPTIONS" {
@@ -16,4 +25,68 @@ func enableCORS(handler http.HandlerFunc) http.HandlerFunc {
 
 		handler(w, r)
 	}
-}
\ No newline at end of file
+}
+
+// requireAuth verifies the JWT of the request and lets the given roles through. The handler finds the
+// identity in the request context, and it is passed along to the services it calls.
+func requireAuth(verifier *auth.Verifier, handler http.HandlerFunc, roles ...auth.Role) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := requestToken(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := verifier.Verify(token)
+		if err != nil {
+			log.Printf("Rejected the token of a request to %s: %v", r.URL.Path, err)
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		if !slices.Contains(roles, identity.Role) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		handler(w, withoutQueryToken(r.WithContext(auth.WithIdentity(r.Context(), identity))))
+	}
+}
+
+// requestToken reads the bearer token of the Authorization header. Browsers can't set headers on
+// WebSocket connections, those pass it in the token query parameter instead.
+func requestToken(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			return "", errors.New("the Authorization header must hold a bearer token")
+		}
+		return token, nil
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		if token := r.URL.Query().Get("token"); token != "" {
+			return token, nil
+		}
+	}
+
+	return "", errors.New("authentication required")
+}
+
+// withoutQueryToken removes the token from the URL of the request, so it is not logged or traced further on
+func withoutQueryToken(r *http.Request) *http.Request {
+	query := r.URL.Query()
+	if !query.Has("token") {
+		return r
+	}
+
+	query.Del("token")
+
+	// The request was copied by WithContext, its URL was not
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+
+	return r
+}
@@ -5,15 +5,16 @@ import (
 	"ride-sharing/shared/types"
 )
 
+// The user of the requests is the authenticated one, it is not read from their body
+
 type previewTripRequest struct {
-	UserID      string           `json:"userID"`
 	Pickup      types.Coordinate `json:"pickup"`
 	Destination types.Coordinate `json:"destination"`
 }
 
-func (p *previewTripRequest) toProto() *pb.PreviewTripRequest {
+func (p *previewTripRequest) toProto(userID string) *pb.PreviewTripRequest {
 	return &pb.PreviewTripRequest{
-		UserID: p.UserID,
+		UserID: userID,
 		StartLocation: &pb.Coordinate{
 			Latitude:  p.Pickup.Latitude,
 			Longitude: p.Pickup.Longitude,
@@ -27,12 +28,24 @@ func (p *previewTripRequest) toProto() *pb.PreviewTripRequest {
 
 type startTripRequest struct {
 	RideFareID string `json:"rideFareID"`
-	UserID     string `json:"userID"`
 }
 
-func (c *startTripRequest) toProto() *pb.CreateTripRequest {
+func (c *startTripRequest) toProto(userID, idempotencyKey string) *pb.CreateTripRequest {
 	return &pb.CreateTripRequest{
-		RideFareID: c.RideFareID,
-		UserID:     c.UserID,
+		RideFareID:     c.RideFareID,
+		UserID:         userID,
+		IdempotencyKey: idempotencyKey,
 	}
-}
\ No newline at end of file
+}
+
+type cancelTripRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (c *cancelTripRequest) toProto(tripID, userID string) *pb.CancelTripRequest {
+	return &pb.CancelTripRequest{
+		TripID: tripID,
+		UserID: userID,
+		Reason: c.Reason,
+	}
+}
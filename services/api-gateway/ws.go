@@ -1,20 +1,62 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"ride-sharing/services/api-gateway/grpc_clients"
+	"ride-sharing/shared/auth"
 	"ride-sharing/shared/contracts"
+	"ride-sharing/shared/env"
 	"ride-sharing/shared/messaging"
 	"ride-sharing/shared/proto/driver"
+	"ride-sharing/shared/proto/trip"
+	"ride-sharing/shared/types"
+	"strconv"
+	"time"
 )
 
 var (
-	connManager = messaging.NewConnectionManager()
+	connManager = messaging.NewConnectionManager(connectionConfig())
+
+	// notificationQueues are consumed once for the whole gateway by startNotifications, their messages
+	// are routed to the rider or driver connection of their owner
+	notificationQueues = []string{
+		messaging.NotifyDriverNoDriversFoundQueue,
+		messaging.NotifyDriverAssignQueue,
+		messaging.NotifyPaymentSessionCreatedQueue,
+		messaging.NotifyTripCancelledQueue,
+		messaging.NotifyTripProgressQueue,
+		messaging.NotifyDriverLocationQueue,
+		messaging.DriverCmdTripRequestQueue,
+	}
+
+	// driverLocationInterval is the minimum time between two location updates forwarded for the same driver
+	driverLocationInterval = time.Duration(env.GetInt("DRIVER_LOCATION_THROTTLE_MS", 1000)) * time.Millisecond
+
+	// driverHeartbeatInterval is how often the session of a connected driver is refreshed, well within
+	// the time the driver service waits before it stops offering them trips
+	driverHeartbeatInterval = time.Duration(env.GetInt("DRIVER_HEARTBEAT_SECONDS", 30)) * time.Second
 )
 
-func handleRidersWebSocket(w http.ResponseWriter, r *http.Request, rb *messaging.RabbitMQ) {
+func connectionConfig() *messaging.ConnectionConfig {
+	cfg := messaging.DefaultConnectionConfig()
+	cfg.PingInterval = time.Duration(env.GetInt("WS_PING_INTERVAL_SECONDS", 10)) * time.Second
+	cfg.PongTimeout = time.Duration(env.GetInt("WS_PONG_TIMEOUT_SECONDS", 25)) * time.Second
+	cfg.WriteTimeout = time.Duration(env.GetInt("WS_WRITE_TIMEOUT_SECONDS", 10)) * time.Second
+	cfg.SendQueueSize = env.GetInt("WS_SEND_QUEUE_SIZE", cfg.SendQueueSize)
+	return cfg
+}
+
+func startNotifications(rb *messaging.RabbitMQ) error {
+	return messaging.NewQueueConsumer(rb, connManager, notificationQueues...).Start()
+}
+
+func handleRidersWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := connManager.Upgrade(w, r)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
@@ -23,30 +65,14 @@ func handleRidersWebSocket(w http.ResponseWriter, r *http.Request, rb *messaging
 
 	defer conn.Close()
 
-	userID := r.URL.Query().Get("userID")
-	if userID == "" {
-		log.Println("No user ID provided")
-		return
-	}
+	// The rider authenticated by the token
+	userID := auth.FromContext(r.Context()).UserID
 
 	// Add connection to manager
 	connManager.Add(userID, conn)
-	defer connManager.Remove(userID)
-
-	// Initialize queue consumers
-	queues := []string{
-		messaging.NotifyDriverNoDriversFoundQueue,
-		messaging.NotifyDriverAssignQueue,
-		messaging.NotifyPaymentSessionCreatedQueue,
-	}
-
-	for _, q := range queues {
-		consumer := messaging.NewQueueConsumer(rb, connManager, q)
+	defer connManager.Remove(userID, conn)
 
-		if err := consumer.Start(); err != nil {
-			log.Printf("Failed to start consumer for queue: %s: err: %v", q, err)
-		}
-	}
+	replayMissedMessages(r, userID)
 
 	for {
 		_, message, err := conn.ReadMessage()
@@ -68,11 +94,9 @@ func handleDriversWebSocket(w http.ResponseWriter, r *http.Request, rb *messagin
 
 	defer conn.Close()
 
-	userID := r.URL.Query().Get("userID")
-	if userID == "" {
-		log.Println("No user ID provided")
-		return
-	}
+	// The driver authenticated by the token
+	identity := auth.FromContext(r.Context())
+	userID := identity.UserID
 
 	packageSlug := r.URL.Query().Get("packageSlug")
 	if packageSlug == "" {
@@ -90,16 +114,28 @@ func handleDriversWebSocket(w http.ResponseWriter, r *http.Request, rb *messagin
 		log.Fatal(err)
 	}
 
-	// Closing connections
+	// Closing connections, as soon as the read loop ends: a driver that stops answering the pings fails
+	// its next read within the pong timeout
 	defer func() {
-		connManager.Remove(userID)
+		connManager.Remove(userID, conn)
+		defer driverService.Close()
 
-		driverService.Client.UnregisterDriver(ctx, &driver.RegisterDriverRequest{
+		// The driver reconnected meanwhile and is registered by its new connection
+		if _, reconnected := connManager.Get(userID); reconnected {
+			return
+		}
+
+		// The request context may be done once the connection dropped, the driver service still needs its identity
+		ctx, cancel := context.WithTimeout(auth.WithIdentity(context.Background(), identity), 5*time.Second)
+		defer cancel()
+
+		if _, err := driverService.Client.UnregisterDriver(ctx, &driver.RegisterDriverRequest{
 			DriverID:    userID,
 			PackageSlug: packageSlug,
-		})
-
-		driverService.Close()
+		}); err != nil {
+			log.Printf("Error unregistering driver %s: %v", userID, err)
+			return
+		}
 
 		log.Println("Driver unregistered: ", userID)
 	}()
@@ -121,18 +157,23 @@ func handleDriversWebSocket(w http.ResponseWriter, r *http.Request, rb *messagin
 		return
 	}
 
-	// Initialize queue consumers
-	queues := []string{
-		messaging.DriverCmdTripRequestQueue,
-	}
+	// After the registration, so the client knows the driver before the missed trip requests
+	replayMissedMessages(r, userID)
 
-	for _, q := range queues {
-		consumer := messaging.NewQueueConsumer(rb, connManager, q)
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		keepDriverSession(heartbeatCtx, driverService.Client, userID, packageSlug)
+	}()
 
-		if err := consumer.Start(); err != nil {
-			log.Printf("Failed to start consumer for queue: %s: err: %v", q, err)
-		}
-	}
+	// Stopped before the driver is unregistered, so it doesn't register them again
+	defer func() {
+		stopHeartbeat()
+		<-heartbeatDone
+	}()
+
+	var lastLocationAt time.Time
 
 	for {
 		_, message, err := conn.ReadMessage()
@@ -155,18 +196,155 @@ func handleDriversWebSocket(w http.ResponseWriter, r *http.Request, rb *messagin
 		// Handle the different message type
 		switch driverMsg.Type {
 		case contracts.DriverCmdLocation:
-			// Handle driver location update in the future
-			continue
+			// Drop updates that arrive faster than the throttle interval
+			if time.Since(lastLocationAt) < driverLocationInterval {
+				continue
+			}
+
+			var data messaging.DriverLocationData
+			if err := json.Unmarshal(driverMsg.Data, &data); err != nil {
+				log.Printf("Error unmarshaling driver location: %v", err)
+				continue
+			}
+
+			if err := validateLocation(data.Location); err != nil {
+				log.Printf("Invalid location from driver %s: %v", userID, err)
+				continue
+			}
+
+			lastLocationAt = time.Now()
+
+			if err := messaging.Publish(ctx, rb, contracts.DriverCmdLocation, userID, data); err != nil {
+				log.Printf("Error publishing message to RabbitMQ: %v", err)
+			}
 		case contracts.DriverCmdTripAccept, contracts.DriverCmdTripDecline:
+			var data messaging.DriverTripResponseData
+			if err := json.Unmarshal(driverMsg.Data, &data); err != nil {
+				log.Printf("Error unmarshaling trip response data: %v", err)
+				continue
+			}
+
 			// Forward the message to RabbitMQ
-			if err := rb.PublishMessage(ctx, driverMsg.Type, contracts.AmqpMessage{
-				OwnerID: userID,
-				Data:    driverMsg.Data,
-			}); err != nil {
+			if err := messaging.Publish(ctx, rb, driverMsg.Type, userID, data); err != nil {
+				log.Printf("Error publishing message to RabbitMQ: %v", err)
+			}
+		case contracts.DriverCmdArrived, contracts.DriverCmdTripStart, contracts.DriverCmdTripComplete:
+			var data messaging.DriverTripProgressData
+			if err := json.Unmarshal(driverMsg.Data, &data); err != nil {
+				log.Printf("Error unmarshaling trip progress data: %v", err)
+				continue
+			}
+
+			// Forward the message to RabbitMQ
+			if err := messaging.Publish(ctx, rb, driverMsg.Type, userID, data); err != nil {
 				log.Printf("Error publishing message to RabbitMQ: %v", err)
 			}
+		case contracts.DriverCmdTripCancel:
+			var data messaging.TripCancelData
+			if err := json.Unmarshal(driverMsg.Data, &data); err != nil {
+				log.Printf("Error unmarshaling trip cancel data: %v", err)
+				continue
+			}
+
+			tripService, err := grpc_clients.NewTripServiceClient()
+			if err != nil {
+				log.Printf("Error creating trip service client: %v", err)
+				continue
+			}
+
+			if _, err := tripService.Client.CancelTrip(ctx, &trip.CancelTripRequest{
+				TripID: data.TripID,
+				UserID: userID,
+				Reason: data.Reason,
+			}); err != nil {
+				log.Printf("Error cancelling trip %s: %v", data.TripID, err)
+			}
+
+			tripService.Close()
+		case contracts.DriverCmdSetStatus:
+			var data messaging.DriverStatusData
+			if err := json.Unmarshal(driverMsg.Data, &data); err != nil {
+				log.Printf("Error unmarshaling driver status data: %v", err)
+				continue
+			}
+
+			res, err := driverService.Client.SetDriverStatus(ctx, &driver.SetDriverStatusRequest{
+				DriverID: userID,
+				Status:   data.Status,
+			})
+			if err != nil {
+				log.Printf("Error setting driver %s status: %v", userID, err)
+				continue
+			}
+
+			if err := connManager.SendMessage(userID, contracts.WSMessage{
+				Type: contracts.DriverCmdSetStatus,
+				Data: res.Driver,
+			}); err != nil {
+				log.Printf("Error sending message: %v", err)
+			}
 		default:
 			log.Printf("Unknown message type: %s", driverMsg.Type)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// keepDriverSession registers the driver again periodically until the context is done. Registering again keeps the session as it is and marks the driver as still connected.
+func keepDriverSession(ctx context.Context, client driver.DriverServiceClient, driverID, packageSlug string) {
+	ticker := time.NewTicker(driverHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := client.RegisterDriver(ctx, &driver.RegisterDriverRequest{
+				DriverID:    driverID,
+				PackageSlug: packageSlug,
+			}); err != nil && ctx.Err() == nil {
+				log.Printf("Error refreshing the session of driver %s: %v", driverID, err)
+			}
+		}
+	}
+}
+
+// replayMissedMessages sends the notifications kept while the user was offline. The client passes the last
+// sequence number it received as lastSeq, everything is replayed without it.
+func replayMissedMessages(r *http.Request, userID string) {
+	var lastSeq uint64
+	if s := r.URL.Query().Get("lastSeq"); s != "" {
+		seq, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			log.Printf("Invalid lastSeq %q from user %s, replaying every message", s, userID)
+		}
+		lastSeq = seq
+	}
+
+	if err := connManager.Replay(r.Context(), userID, lastSeq); err != nil {
+		log.Printf("Failed to replay the missed messages of user %s: %v", userID, err)
+	}
+}
+
+func validateLocation(location *types.Coordinate) error {
+	if location == nil {
+		return errors.New("location is required")
+	}
+
+	// NaN compares false to everything, it would pass the range checks
+	for _, v := range []float64{location.Latitude, location.Longitude} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("location is not a finite number: %f, %f", location.Latitude, location.Longitude)
+		}
+	}
+
+	if location.Latitude < -90 || location.Latitude > 90 {
+		return fmt.Errorf("latitude out of range: %f", location.Latitude)
+	}
+
+	if location.Longitude < -180 || location.Longitude > 180 {
+		return fmt.Errorf("longitude out of range: %f", location.Longitude)
+	}
+
+	return nil
+}
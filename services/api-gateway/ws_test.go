@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"ride-sharing/shared/types"
+)
+
+func TestValidateLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		location *types.Coordinate
+		wantErr  bool
+	}{
+		{"valid", &types.Coordinate{Latitude: 48.8566, Longitude: 2.3522}, false},
+		{"bounds", &types.Coordinate{Latitude: -90, Longitude: 180}, false},
+		{"no location", nil, true},
+		{"latitude out of range", &types.Coordinate{Latitude: 90.5, Longitude: 2.3522}, true},
+		{"longitude out of range", &types.Coordinate{Latitude: 48.8566, Longitude: -180.5}, true},
+		{"NaN latitude", &types.Coordinate{Latitude: math.NaN(), Longitude: 2.3522}, true},
+		{"NaN longitude", &types.Coordinate{Latitude: 48.8566, Longitude: math.NaN()}, true},
+		{"infinite latitude", &types.Coordinate{Latitude: math.Inf(1), Longitude: 2.3522}, true},
+		{"infinite longitude", &types.Coordinate{Latitude: 48.8566, Longitude: math.Inf(-1)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLocation(tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLocation() = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
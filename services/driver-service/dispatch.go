@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"ride-sharing/shared/contracts"
+	"ride-sharing/shared/messaging"
+	"ride-sharing/shared/types"
+)
+
+// DispatchConfig controls how long and how often a trip is offered to drivers
+type DispatchConfig struct {
+	OfferTimeout time.Duration // how long a driver has to answer an offer
+	MaxAttempts  int           // how many drivers are offered the trip before giving up
+	TotalTimeout time.Duration // how long a trip is dispatched before giving up
+	TickInterval time.Duration // how often expired offers are looked for
+	Lease        time.Duration // how long a replica holds an offer it is working on
+}
+
+func DefaultDispatchConfig() *DispatchConfig {
+	return &DispatchConfig{
+		OfferTimeout: 15 * time.Second,
+		MaxAttempts:  5,
+		TotalTimeout: 2 * time.Minute,
+		TickInterval: time.Second,
+		Lease:        30 * time.Second,
+	}
+}
+
+// dispatcher offers a trip to the ranked candidates one at a time, until one accepts or it gives up.
+// Its state lives in the DispatchStore so a restart picks up where it left off, and the replicas
+// claim an offer in the store before changing it.
+type dispatcher struct {
+	rabbitmq *messaging.RabbitMQ
+	service  *Service
+	store    DispatchStore
+	cfg      *DispatchConfig
+}
+
+func NewDispatcher(rabbitmq *messaging.RabbitMQ, service *Service, store DispatchStore, cfg *DispatchConfig) *dispatcher {
+	return &dispatcher{
+		rabbitmq: rabbitmq,
+		service:  service,
+		store:    store,
+		cfg:      cfg,
+	}
+}
+
+// Start begins dispatching a newly created trip
+func (d *dispatcher) Start(ctx context.Context, payload messaging.TripEventData) error {
+	existing, err := d.store.Get(ctx, payload.Trip.Id)
+	if err != nil {
+		return err
+	}
+
+	// A redelivered trip.event.created must not restart the dispatch
+	if existing != nil {
+		return nil
+	}
+
+	trip, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	offer := &dispatchOffer{
+		TripID:    payload.Trip.Id,
+		RiderID:   payload.Trip.UserID,
+		Trip:      trip,
+		Excluded:  make(map[string]string),
+		ExpiresAt: time.Now().Add(d.cfg.TotalTimeout),
+	}
+
+	return d.offerNext(ctx, offer)
+}
+
+// Decline records that the driver doesn't want the trip and moves on to the next candidate
+func (d *dispatcher) Decline(ctx context.Context, tripID, driverID string) error {
+	offer, err := d.store.Claim(ctx, tripID, d.cfg.Lease)
+	if err != nil {
+		return err
+	}
+
+	if offer == nil {
+		return nil
+	}
+
+	offer.Excluded[driverID] = offerDeclined
+
+	// A late decline from a driver whose offer already timed out changes nothing
+	if driverID != offer.DriverID {
+		return d.store.Save(ctx, offer)
+	}
+
+	if err := d.service.ReleaseOffer(ctx, driverID, tripID); err != nil {
+		d.release(ctx, offer)
+		return err
+	}
+
+	return d.offerNext(ctx, offer)
+}
+
+// Finish stops dispatching the trip, once a driver was assigned or the trip was cancelled
+func (d *dispatcher) Finish(ctx context.Context, tripID string) error {
+	offer, err := d.store.Claim(ctx, tripID, d.cfg.Lease)
+	if err != nil {
+		return err
+	}
+
+	if offer == nil {
+		return nil
+	}
+
+	// Frees the driver if the trip was cancelled while they were still deciding
+	if offer.DriverID != "" {
+		if err := d.service.ReleaseOffer(ctx, offer.DriverID, tripID); err != nil {
+			d.release(ctx, offer)
+			return err
+		}
+	}
+
+	return d.store.Delete(ctx, tripID)
+}
+
+// Run moves on from the offers nobody answered in time, until the context is cancelled
+func (d *dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.expireOffers(ctx); err != nil {
+				log.Printf("Failed to expire the dispatch offers: %v", err)
+			}
+		}
+	}
+}
+
+// expireOffers claims the offers nobody answered in time, another replica doesn't handle them again
+func (d *dispatcher) expireOffers(ctx context.Context) error {
+	expired, err := d.store.ClaimExpired(ctx, time.Now(), d.cfg.Lease)
+
+	for _, offer := range expired {
+		if offer.DriverID != "" {
+			log.Printf("Driver %s did not answer the offer for trip %s in time", offer.DriverID, offer.TripID)
+			offer.Excluded[offer.DriverID] = offerTimedOut
+
+			if err := d.service.ReleaseOffer(ctx, offer.DriverID, offer.TripID); err != nil {
+				log.Printf("Failed to release driver %s from trip %s: %v", offer.DriverID, offer.TripID, err)
+				d.release(ctx, offer)
+				continue
+			}
+		}
+
+		if err := d.offerNext(ctx, offer); err != nil {
+			log.Printf("Failed to dispatch trip %s: %v", offer.TripID, err)
+		}
+	}
+
+	return err
+}
+
+// release ends the claim of an offer that could not be changed, so it is retried without waiting for the lease
+func (d *dispatcher) release(ctx context.Context, offer *dispatchOffer) {
+	if err := d.store.Release(ctx, offer); err != nil {
+		log.Printf("Failed to release the dispatch offer of trip %s: %v", offer.TripID, err)
+	}
+}
+
+// offerNext offers the trip to the closest candidate who hasn't declined or ignored it yet. The offer is
+// claimed by the caller, or new, and saving it ends the claim before the driver is notified.
+func (d *dispatcher) offerNext(ctx context.Context, offer *dispatchOffer) error {
+	var payload messaging.TripEventData
+	if err := json.Unmarshal(offer.Trip, &payload); err != nil {
+		d.release(ctx, offer)
+		return err
+	}
+
+	if offer.Attempts >= d.cfg.MaxAttempts || time.Now().After(offer.ExpiresAt) {
+		return d.giveUp(ctx, offer)
+	}
+
+	var pickup *types.Coordinate
+	if p := payload.Trip.GetPickup(); p != nil {
+		pickup = &types.Coordinate{Latitude: p.Latitude, Longitude: p.Longitude}
+	}
+
+	candidates, err := d.service.FindAvailableDrivers(ctx, payload.Trip.SelectedFare.PackageSlug, pickup)
+	if err != nil {
+		d.release(ctx, offer)
+		return err
+	}
+
+	// Reserve the closest candidate who can still be offered the trip, so no other trip is offered to them meanwhile
+	var next *driverCandidate
+	for i := range candidates {
+		if _, excluded := offer.Excluded[candidates[i].DriverID]; excluded {
+			continue
+		}
+
+		if err := d.service.OfferTrip(ctx, candidates[i].DriverID, offer.TripID); err != nil {
+			if !errors.Is(err, ErrDriverBusy) {
+				d.release(ctx, offer)
+				return err
+			}
+			continue
+		}
+
+		next = &candidates[i]
+		break
+	}
+
+	if next == nil {
+		return d.giveUp(ctx, offer)
+	}
+
+	offer.DriverID = next.DriverID
+	offer.Attempts++
+	offer.OfferExpiresAt = time.Now().Add(d.cfg.OfferTimeout)
+
+	if err := d.store.Save(ctx, offer); err != nil {
+		d.service.ReleaseOffer(ctx, next.DriverID, offer.TripID)
+		d.release(ctx, offer)
+		return err
+	}
+
+	log.Printf("Offering trip %s to driver %s (attempt %d/%d, %.2fkm, ETA %v)",
+		offer.TripID, next.DriverID, offer.Attempts, d.cfg.MaxAttempts, next.DistanceKm, next.PickupETA)
+
+	// Notify the driver about a potential trip
+	if err := messaging.Publish(ctx, d.rabbitmq, contracts.DriverCmdTripRequest, next.DriverID, payload); err != nil {
+		log.Printf("Failed to publish message to exchange: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// giveUp tells the rider that no driver took the trip and forgets about it
+func (d *dispatcher) giveUp(ctx context.Context, offer *dispatchOffer) error {
+	log.Printf("No drivers found for trip %s after %d attempts", offer.TripID, offer.Attempts)
+
+	var payload messaging.TripEventData
+	if err := json.Unmarshal(offer.Trip, &payload); err != nil {
+		d.release(ctx, offer)
+		return err
+	}
+
+	if err := messaging.Publish(ctx, d.rabbitmq, contracts.TripEventNoDriversFound, offer.RiderID, payload); err != nil {
+		log.Printf("Failed to publish message to exchange: %v", err)
+		d.release(ctx, offer)
+		return err
+	}
+
+	return d.store.Delete(ctx, offer.TripID)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"ride-sharing/shared/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reasons a driver is excluded from a trip's dispatch
+const (
+	offerDeclined = "declined"
+	offerTimedOut = "timed_out"
+)
+
+// ErrOfferClaimed is returned while another replica is working on the dispatch offer
+var ErrOfferClaimed = errors.New("dispatch offer is claimed by another replica")
+
+// dispatchOffer is the dispatch state of a trip that is still looking for a driver
+type dispatchOffer struct {
+	TripID         string            `bson:"_id"`
+	RiderID        string            `bson:"riderID"`
+	Trip           []byte            `bson:"trip"`     // JSON encoded messaging.TripEventData, sent with every offer
+	DriverID       string            `bson:"driverID"` // driver currently holding the offer
+	OfferExpiresAt time.Time         `bson:"offerExpiresAt"`
+	Attempts       int               `bson:"attempts"`
+	Excluded       map[string]string `bson:"excluded"`              // driver ID -> declined or timed_out
+	ExpiresAt      time.Time         `bson:"expiresAt"`             // the dispatch gives up after this
+	LockedUntil    *time.Time        `bson:"lockedUntil,omitempty"` // set while a replica works on the offer
+}
+
+// DispatchStore keeps the offers shared by the replicas. A replica claims an offer before changing it,
+// the claim ends when the offer is saved, released or deleted, or after the lease if the replica died.
+type DispatchStore interface {
+	// Save stores the offer and ends its claim. It returns ErrOfferClaimed if the lease ran out and
+	// another replica claimed the offer meanwhile.
+	Save(ctx context.Context, offer *dispatchOffer) error
+	// Get returns nil if the trip is not being dispatched
+	Get(ctx context.Context, tripID string) (*dispatchOffer, error)
+	// Claim locks the offer of the trip until the lease ends. It returns nil if the trip is not being
+	// dispatched, and ErrOfferClaimed if another replica holds it.
+	Claim(ctx context.Context, tripID string, lease time.Duration) (*dispatchOffer, error)
+	// ClaimExpired locks the unclaimed offers whose deadline passed before now
+	ClaimExpired(ctx context.Context, now time.Time, lease time.Duration) ([]*dispatchOffer, error)
+	// Release ends the claim of an offer left unchanged
+	Release(ctx context.Context, offer *dispatchOffer) error
+	Delete(ctx context.Context, tripID string) error
+}
+
+type inmemDispatchStore struct {
+	offers map[string]*dispatchOffer
+	mu     sync.RWMutex
+}
+
+func NewInmemDispatchStore() *inmemDispatchStore {
+	return &inmemDispatchStore{
+		offers: make(map[string]*dispatchOffer),
+	}
+}
+
+// claimedBy tells if the stored offer is still claimed with the lease the caller got
+func claimedBy(stored, offer *dispatchOffer) bool {
+	return stored != nil && stored.LockedUntil != nil && offer.LockedUntil != nil &&
+		stored.LockedUntil.Equal(*offer.LockedUntil)
+}
+
+// copyOffer returns a copy the caller can change without touching the stored offer
+func copyOffer(offer *dispatchOffer) *dispatchOffer {
+	c := *offer
+	c.Excluded = maps.Clone(offer.Excluded)
+	return &c
+}
+
+func (s *inmemDispatchStore) Save(ctx context.Context, offer *dispatchOffer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if offer.LockedUntil != nil && !claimedBy(s.offers[offer.TripID], offer) {
+		return ErrOfferClaimed
+	}
+
+	saved := copyOffer(offer)
+	saved.LockedUntil = nil
+	s.offers[offer.TripID] = saved
+	return nil
+}
+
+func (s *inmemDispatchStore) Get(ctx context.Context, tripID string) (*dispatchOffer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	offer, ok := s.offers[tripID]
+	if !ok {
+		return nil, nil
+	}
+	return copyOffer(offer), nil
+}
+
+func (s *inmemDispatchStore) Claim(ctx context.Context, tripID string, lease time.Duration) (*dispatchOffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offer, ok := s.offers[tripID]
+	if !ok {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if offer.LockedUntil != nil && offer.LockedUntil.After(now) {
+		return nil, ErrOfferClaimed
+	}
+
+	lockedUntil := now.Add(lease)
+	offer.LockedUntil = &lockedUntil
+	return copyOffer(offer), nil
+}
+
+func (s *inmemDispatchStore) ClaimExpired(ctx context.Context, now time.Time, lease time.Duration) ([]*dispatchOffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockedUntil := now.Add(lease)
+
+	var expired []*dispatchOffer
+	for _, offer := range s.offers {
+		if offer.OfferExpiresAt.After(now) || (offer.LockedUntil != nil && offer.LockedUntil.After(now)) {
+			continue
+		}
+
+		offer.LockedUntil = &lockedUntil
+		expired = append(expired, copyOffer(offer))
+	}
+	return expired, nil
+}
+
+func (s *inmemDispatchStore) Release(ctx context.Context, offer *dispatchOffer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored := s.offers[offer.TripID]; claimedBy(stored, offer) {
+		stored.LockedUntil = nil
+	}
+	return nil
+}
+
+func (s *inmemDispatchStore) Delete(ctx context.Context, tripID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.offers, tripID)
+	return nil
+}
+
+type mongoDispatchStore struct {
+	db *mongo.Database
+}
+
+func NewMongoDispatchStore(db *mongo.Database) *mongoDispatchStore {
+	return &mongoDispatchStore{db: db}
+}
+
+func (s *mongoDispatchStore) Save(ctx context.Context, offer *dispatchOffer) error {
+	saved := *offer
+	saved.LockedUntil = nil
+
+	// A new offer is inserted, a claimed one is only replaced while the claim holds
+	if offer.LockedUntil == nil {
+		_, err := s.db.Collection(db.DispatchOffersCollection).ReplaceOne(
+			ctx,
+			bson.M{"_id": offer.TripID},
+			saved,
+			options.Replace().SetUpsert(true),
+		)
+		return err
+	}
+
+	result, err := s.db.Collection(db.DispatchOffersCollection).ReplaceOne(
+		ctx,
+		bson.M{"_id": offer.TripID, "lockedUntil": *offer.LockedUntil},
+		saved,
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrOfferClaimed
+	}
+	return nil
+}
+
+func (s *mongoDispatchStore) Get(ctx context.Context, tripID string) (*dispatchOffer, error) {
+	result := s.db.Collection(db.DispatchOffersCollection).FindOne(ctx, bson.M{"_id": tripID})
+	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, result.Err()
+	}
+
+	var offer dispatchOffer
+	if err := result.Decode(&offer); err != nil {
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+// unclaimed matches the offers no replica holds at the time
+func unclaimed(now time.Time) bson.A {
+	return bson.A{
+		bson.M{"lockedUntil": nil},
+		bson.M{"lockedUntil": bson.M{"$lte": now}},
+	}
+}
+
+// claim locks one offer matching the filter. The offer is read back after the update, so its lease has
+// the precision MongoDB stores and matches the filters of Save and Release.
+func (s *mongoDispatchStore) claim(ctx context.Context, filter bson.M, lockedUntil time.Time) (*dispatchOffer, error) {
+	result := s.db.Collection(db.DispatchOffersCollection).FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"lockedUntil": lockedUntil}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, result.Err()
+	}
+
+	var offer dispatchOffer
+	if err := result.Decode(&offer); err != nil {
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+func (s *mongoDispatchStore) Claim(ctx context.Context, tripID string, lease time.Duration) (*dispatchOffer, error) {
+	now := time.Now()
+
+	offer, err := s.claim(ctx, bson.M{"_id": tripID, "$or": unclaimed(now)}, now.Add(lease))
+	if err != nil || offer != nil {
+		return offer, err
+	}
+
+	// Nothing matched, tell a missing offer from a claimed one
+	existing, err := s.Get(ctx, tripID)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	return nil, ErrOfferClaimed
+}
+
+func (s *mongoDispatchStore) ClaimExpired(ctx context.Context, now time.Time, lease time.Duration) ([]*dispatchOffer, error) {
+	filter := bson.M{
+		"offerExpiresAt": bson.M{"$lte": now},
+		"$or":            unclaimed(now),
+	}
+
+	// Claimed one at a time, so the replicas share the expired offers without handling one twice
+	var offers []*dispatchOffer
+	for {
+		offer, err := s.claim(ctx, filter, now.Add(lease))
+		if err != nil {
+			return offers, err
+		}
+		if offer == nil {
+			return offers, nil
+		}
+
+		offers = append(offers, offer)
+	}
+}
+
+func (s *mongoDispatchStore) Release(ctx context.Context, offer *dispatchOffer) error {
+	if offer.LockedUntil == nil {
+		return nil
+	}
+
+	_, err := s.db.Collection(db.DispatchOffersCollection).UpdateOne(
+		ctx,
+		bson.M{"_id": offer.TripID, "lockedUntil": *offer.LockedUntil},
+		bson.M{"$unset": bson.M{"lockedUntil": ""}},
+	)
+	return err
+}
+
+func (s *mongoDispatchStore) Delete(ctx context.Context, tripID string) error {
+	_, err := s.db.Collection(db.DispatchOffersCollection).DeleteOne(ctx, bson.M{"_id": tripID})
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInmemDispatchStoreClaims(t *testing.T) {
+	type step struct {
+		op      string // claim, claimExpired, save, release, expire or delete
+		replica string // whose claim is used
+		want    int    // offers claimed by claimExpired
+		wantErr error
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "claimed offer is not claimed again",
+			steps: []step{
+				{op: "claim", replica: "a"},
+				{op: "claim", replica: "b", wantErr: ErrOfferClaimed},
+				{op: "claimExpired", replica: "b", want: 0},
+			},
+		},
+		{
+			name: "expired offer is claimed by one replica",
+			steps: []step{
+				{op: "claimExpired", replica: "a", want: 1},
+				{op: "claimExpired", replica: "b", want: 0},
+				{op: "claim", replica: "b", wantErr: ErrOfferClaimed},
+			},
+		},
+		{
+			name: "saved offer is claimed again",
+			steps: []step{
+				{op: "claim", replica: "a"},
+				{op: "save", replica: "a"},
+				{op: "claim", replica: "b"},
+			},
+		},
+		{
+			name: "released offer is claimed again",
+			steps: []step{
+				{op: "claimExpired", replica: "a", want: 1},
+				{op: "release", replica: "a"},
+				{op: "claimExpired", replica: "b", want: 1},
+			},
+		},
+		{
+			name: "claim is taken over after the lease",
+			steps: []step{
+				{op: "claim", replica: "a"},
+				{op: "expire"},
+				{op: "claim", replica: "b"},
+			},
+		},
+		{
+			name: "replica that lost its claim cannot save nor release",
+			steps: []step{
+				{op: "claim", replica: "a"},
+				{op: "expire"},
+				{op: "claim", replica: "b"},
+				{op: "save", replica: "a", wantErr: ErrOfferClaimed},
+				{op: "release", replica: "a"},
+				{op: "claim", replica: "c", wantErr: ErrOfferClaimed},
+				{op: "save", replica: "b"},
+			},
+		},
+		{
+			name: "deleted offer is not dispatched",
+			steps: []step{
+				{op: "claim", replica: "a"},
+				{op: "delete"},
+				{op: "claim", replica: "b"},
+				{op: "claimExpired", replica: "b", want: 0},
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewInmemDispatchStore()
+			if err := store.Save(ctx, &dispatchOffer{
+				TripID:         "trip-1",
+				Excluded:       map[string]string{},
+				OfferExpiresAt: time.Now().Add(-time.Second),
+			}); err != nil {
+				t.Fatalf("Save() = %v", err)
+			}
+
+			claims := make(map[string]*dispatchOffer)
+
+			for i, s := range tt.steps {
+				var err error
+				switch s.op {
+				case "claim":
+					var offer *dispatchOffer
+					offer, err = store.Claim(ctx, "trip-1", time.Minute)
+					if offer != nil {
+						claims[s.replica] = offer
+					}
+				case "claimExpired":
+					var offers []*dispatchOffer
+					offers, err = store.ClaimExpired(ctx, time.Now(), time.Minute)
+					if len(offers) != s.want {
+						t.Fatalf("step %d (%s %s) claimed %d offers, want %d", i, s.op, s.replica, len(offers), s.want)
+					}
+					if len(offers) > 0 {
+						claims[s.replica] = offers[0]
+					}
+				case "save":
+					err = store.Save(ctx, claims[s.replica])
+				case "release":
+					err = store.Release(ctx, claims[s.replica])
+				case "expire":
+					// The lease of the stored offer ran out
+					past := time.Now().Add(-time.Second)
+					store.offers["trip-1"].LockedUntil = &past
+				case "delete":
+					err = store.Delete(ctx, "trip-1")
+				}
+
+				if !errors.Is(err, s.wantErr) {
+					t.Fatalf("step %d (%s %s) = %v, want %v", i, s.op, s.replica, err, s.wantErr)
+				}
+			}
+		})
+	}
+}
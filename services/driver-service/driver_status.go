@@ -0,0 +1,21 @@
+package main
+
+import "errors"
+
+// DriverStatus is the availability of a registered driver
+type DriverStatus string
+
+const (
+	DriverStatusOnline  DriverStatus = "online"   // idle and can be offered trips
+	DriverStatusOffered DriverStatus = "offered"  // holding a trip offer, waiting for their answer
+	DriverStatusEnRoute DriverStatus = "en_route" // assigned to a trip and driving to the pickup
+	DriverStatusOnTrip  DriverStatus = "on_trip"  // the rider is on board
+	DriverStatusOffline DriverStatus = "offline"  // connected, but on a break
+)
+
+var (
+	ErrDriverNotFound      = errors.New("driver is not registered")
+	ErrDriverBusy          = errors.New("driver is busy with a trip")
+	ErrInvalidDriverStatus = errors.New("driver status can only be set to online or offline")
+	ErrNoOffer             = errors.New("driver does not hold the offer of the trip")
+)
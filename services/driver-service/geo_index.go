@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+
+	"github.com/mmcloughlin/geohash"
+)
+
+const (
+	// geoIndexPrecision is the geohash length of the index cells (~1.2km x 0.6km)
+	geoIndexPrecision = 6
+	// maxSearchRings caps how far a search expands around the pickup cell
+	maxSearchRings = 20
+	earthRadiusKm  = 6371.0
+	kmPerDegree    = 111.32
+)
+
+// cellOf returns the index cell containing the point. Driver sessions are indexed by their cell
+// so a search only has to look at the cells around the pickup.
+func cellOf(lat, lon float64) string {
+	return geohash.EncodeWithPrecision(lat, lon, geoIndexPrecision)
+}
+
+// cellsWithin returns the cells to search to find every driver within radiusKm of the point
+func cellsWithin(lat, lon, radiusKm float64) []string {
+	center := cellOf(lat, lon)
+
+	// Expand enough rings of cells around the center to cover the radius in every direction
+	box := geohash.BoundingBox(center)
+	cellHeightKm := (box.MaxLat - box.MinLat) * kmPerDegree
+	cellWidthKm := (box.MaxLng - box.MinLng) * kmPerDegree * math.Cos(lat*math.Pi/180)
+	rings := int(math.Ceil(radiusKm / math.Min(cellHeightKm, cellWidthKm)))
+	if rings > maxSearchRings {
+		rings = maxSearchRings
+	}
+
+	return cellsAround(center, rings)
+}
+
+// cellsAround returns the square of cells that lies within the given number of rings around the center cell
+func cellsAround(center string, rings int) []string {
+	// Walk to the south-west corner, then scan the square row by row
+	corner := center
+	for i := 0; i < rings; i++ {
+		corner = geohash.Neighbor(corner, geohash.SouthWest)
+	}
+
+	size := 2*rings + 1
+	cells := make([]string, 0, size*size)
+
+	row := corner
+	for y := 0; y < size; y++ {
+		cell := row
+		for x := 0; x < size; x++ {
+			cells = append(cells, cell)
+			cell = geohash.Neighbor(cell, geohash.East)
+		}
+		row = geohash.Neighbor(row, geohash.North)
+	}
+
+	return cells
+}
+
+// haversineKm returns the great-circle distance between two points
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
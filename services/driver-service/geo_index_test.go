@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/mmcloughlin/geohash"
+)
+
+func TestCellsAround(t *testing.T) {
+	center := cellOf(37.7749, -122.4194)
+
+	tests := []struct {
+		name  string
+		rings int
+		want  int
+	}{
+		{"center only", 0, 1},
+		{"one ring", 1, 9},
+		{"two rings", 2, 25},
+		{"max rings", maxSearchRings, (2*maxSearchRings + 1) * (2*maxSearchRings + 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells := cellsAround(center, tt.rings)
+
+			if len(cells) != tt.want {
+				t.Fatalf("got %d cells, want %d", len(cells), tt.want)
+			}
+
+			// The square is scanned row by row from the south-west corner, the center is in its middle
+			if got := cells[len(cells)/2]; got != center {
+				t.Errorf("middle cell = %s, want the center %s", got, center)
+			}
+
+			seen := make(map[string]bool, len(cells))
+			for _, cell := range cells {
+				if len(cell) != len(center) {
+					t.Errorf("cell %s has precision %d, want %d", cell, len(cell), len(center))
+				}
+				if seen[cell] {
+					t.Errorf("cell %s is returned twice", cell)
+				}
+				seen[cell] = true
+			}
+		})
+	}
+}
+
+func TestCellsAroundCoversNeighbors(t *testing.T) {
+	center := cellOf(51.5074, -0.1278)
+	cells := cellsAround(center, 1)
+
+	for _, neighbor := range geohash.Neighbors(center) {
+		if !slices.Contains(cells, neighbor) {
+			t.Errorf("neighbor %s of %s is missing", neighbor, center)
+		}
+	}
+}
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+		tolerance              float64
+	}{
+		{"same point", 37.7749, -122.4194, 37.7749, -122.4194, 0, 1e-9},
+		{"one degree of latitude", 0, 0, 1, 0, 111.19, 0.01},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, 111.19, 0.01},
+		{"one degree of longitude at 60N", 60, 0, 60, 1, 55.6, 0.1},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.6, 0.5},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.19, 0.01},
+		{"antipodes", 0, 0, 0, 180, math.Pi * earthRadiusKm, 1e-6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := haversineKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			if math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("haversineKm() = %.3f, want %.3f ± %v", got, tt.want, tt.tolerance)
+			}
+
+			// The distance doesn't depend on the direction
+			if back := haversineKm(tt.lat2, tt.lon2, tt.lat1, tt.lon1); math.Abs(back-got) > 1e-9 {
+				t.Errorf("haversineKm() is %.6f one way and %.6f the other", got, back)
+			}
+		})
+	}
+}
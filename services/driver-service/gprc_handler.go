@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"ride-sharing/shared/auth"
 	pb "ride-sharing/shared/proto/driver"
 
 	"google.golang.org/grpc"
@@ -24,8 +26,19 @@ func NewGrpcHandler(s *grpc.Server, service *Service) {
 }
 
 func (h *driverGrpcHandler) RegisterDriver(ctx context.Context, req *pb.RegisterDriverRequest) (*pb.RegisterDriverResponse, error) {
-	driver, err := h.service.RegisterDriver(req.GetDriverID(), req.GetPackageSlug())
+	// Drivers only act for themselves
+	if err := auth.RequireOwner(ctx, req.GetDriverID()); err != nil {
+		return nil, err
+	}
+
+	driver, err := h.service.RegisterDriver(ctx, req.GetDriverID(), req.GetPackageSlug())
 	if err != nil {
+		switch {
+		case errors.Is(err, ErrDriverNotFound):
+			return nil, status.Errorf(codes.NotFound, "failed to register driver: %v", err)
+		case errors.Is(err, ErrPackageNotApproved):
+			return nil, status.Errorf(codes.PermissionDenied, "failed to register driver: %v", err)
+		}
 		return nil, status.Errorf(codes.Internal, "failed to register driver")
 	}
 
@@ -35,7 +48,13 @@ func (h *driverGrpcHandler) RegisterDriver(ctx context.Context, req *pb.Register
 }
 
 func (h *driverGrpcHandler) UnregisterDriver(ctx context.Context, req *pb.RegisterDriverRequest) (*pb.RegisterDriverResponse, error) {
-	h.service.UnregisterDriver(req.GetDriverID())
+	if err := auth.RequireOwner(ctx, req.GetDriverID()); err != nil {
+		return nil, err
+	}
+
+	if err := h.service.UnregisterDriver(ctx, req.GetDriverID()); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to unregister driver: %v", err)
+	}
 
 	return &pb.RegisterDriverResponse{
 		Driver: &pb.Driver{
@@ -43,3 +62,59 @@ func (h *driverGrpcHandler) UnregisterDriver(ctx context.Context, req *pb.Regist
 		},
 	}, nil
 }
+
+func (h *driverGrpcHandler) SetDriverStatus(ctx context.Context, req *pb.SetDriverStatusRequest) (*pb.SetDriverStatusResponse, error) {
+	if err := auth.RequireOwner(ctx, req.GetDriverID()); err != nil {
+		return nil, err
+	}
+
+	driver, err := h.service.SetStatus(ctx, req.GetDriverID(), DriverStatus(req.GetStatus()))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidDriverStatus):
+			return nil, status.Errorf(codes.InvalidArgument, "failed to set driver status: %v", err)
+		case errors.Is(err, ErrDriverNotFound):
+			return nil, status.Errorf(codes.NotFound, "failed to set driver status: %v", err)
+		case errors.Is(err, ErrDriverBusy):
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to set driver status: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to set driver status: %v", err)
+	}
+
+	return &pb.SetDriverStatusResponse{
+		Driver: driver,
+	}, nil
+}
+
+// GetDriverSupply is called by the trip service for its pricing, without a user
+func (h *driverGrpcHandler) GetDriverSupply(ctx context.Context, req *pb.GetDriverSupplyRequest) (*pb.GetDriverSupplyResponse, error) {
+	count, err := h.service.CountAvailableDrivers(ctx, req.GetGeohash())
+	if err != nil {
+		if errors.Is(err, ErrInvalidGeohash) {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to count the drivers: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to count the drivers: %v", err)
+	}
+
+	return &pb.GetDriverSupplyResponse{
+		AvailableDrivers: int32(count),
+	}, nil
+}
+
+// GetDriverOffer is called by the trip service when a driver accepts a trip, to check they were offered it
+func (h *driverGrpcHandler) GetDriverOffer(ctx context.Context, req *pb.GetDriverOfferRequest) (*pb.GetDriverOfferResponse, error) {
+	driver, err := h.service.GetOffer(ctx, req.GetDriverID(), req.GetTripID())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDriverNotFound):
+			return nil, status.Errorf(codes.NotFound, "failed to get the driver offer: %v", err)
+		case errors.Is(err, ErrNoOffer):
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to get the driver offer: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get the driver offer: %v", err)
+	}
+
+	return &pb.GetDriverOfferResponse{
+		Driver: driver,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"ride-sharing/shared/contracts"
+	"ride-sharing/shared/messaging"
+	pb "ride-sharing/shared/proto/driver"
+)
+
+type locationConsumer struct {
+	rabbitmq *messaging.RabbitMQ
+	service  *Service
+}
+
+func NewLocationConsumer(rabbitmq *messaging.RabbitMQ, service *Service) *locationConsumer {
+	return &locationConsumer{
+		rabbitmq: rabbitmq,
+		service:  service,
+	}
+}
+
+func (c *locationConsumer) Listen() error {
+	router := messaging.NewRouter()
+
+	messaging.On(router, contracts.DriverCmdLocation, func(ctx context.Context, e *messaging.Event[messaging.DriverLocationData]) error {
+		if e.Payload.Location == nil {
+			return nil
+		}
+
+		// The gateway sets the owner to the driver who sent the update
+		driver, riderID, err := c.service.UpdateLocation(ctx, e.OwnerID, e.Payload.Location)
+		if err != nil {
+			// The driver went offline in the meantime, the update is stale
+			log.Printf("Dropping location update: %v", err)
+			return nil
+		}
+
+		if riderID == "" {
+			return nil
+		}
+
+		return c.notifyRider(ctx, riderID, driver)
+	})
+
+	return c.rabbitmq.ConsumeEvents(messaging.DriverLocationQueue, router)
+}
+
+// notifyRider sends the assigned driver's new position to the rider of the trip
+func (c *locationConsumer) notifyRider(ctx context.Context, riderID string, driver *pb.Driver) error {
+	if err := messaging.Publish(ctx, c.rabbitmq, contracts.TripEventDriverLocation, riderID, []*pb.Driver{driver}); err != nil {
+		log.Printf("Failed to publish message to exchange: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -6,12 +6,17 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"ride-sharing/shared/auth"
+	"ride-sharing/shared/db"
 	"ride-sharing/shared/env"
 	"ride-sharing/shared/messaging"
 	"ride-sharing/shared/tracing"
 	"syscall"
+	"time"
 
 	grpcserver "google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var GrpcAddr = ":9092"
@@ -47,9 +52,45 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	svc := NewService()
+	matchingCfg := DefaultMatchingConfig()
+	matchingCfg.SearchRadiusKm = env.GetFloat("DRIVER_SEARCH_RADIUS_KM", matchingCfg.SearchRadiusKm)
+	matchingCfg.MaxCandidates = env.GetInt("DRIVER_SEARCH_MAX_CANDIDATES", matchingCfg.MaxCandidates)
+	matchingCfg.AverageSpeedKmh = env.GetFloat("DRIVER_AVERAGE_SPEED_KMH", matchingCfg.AverageSpeedKmh)
+
+	// Initialize MongoDB
+	mongoClient, err := db.NewMongoClient(ctx, db.NewMongoDefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to initialize MongoDB, err: %v", err)
+	}
+	defer mongoClient.Disconnect(ctx)
+
+	mongoDb := db.GetDatabase(mongoClient, db.NewMongoDefaultConfig())
+
+	// Sessions of drivers no longer heard from are left out of the searches, then deleted
+	sessionCfg := DefaultSessionConfig()
+	sessionCfg.StaleAfter = time.Duration(env.GetInt("DRIVER_SESSION_STALE_SECONDS", int(sessionCfg.StaleAfter.Seconds()))) * time.Second
+	sessionCfg.TTL = time.Duration(env.GetInt("DRIVER_SESSION_TTL_MINUTES", int(sessionCfg.TTL.Minutes()))) * time.Minute
+
+	driverRepo := NewMongoDriverRepository(mongoDb, sessionCfg)
+	if err := driverRepo.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create the driver session indexes: %v", err)
+	}
+	svc := NewService(driverRepo, matchingCfg, env.GetBool("DRIVER_DEMO_PROFILES", false))
+
+	// Drivers are onboarded from a profiles file, without it only the demo profiles can go online
+	if profilesFile := env.GetString("DRIVER_PROFILES_FILE", ""); profilesFile != "" {
+		profiles, err := LoadProfiles(profilesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := svc.ImportProfiles(ctx, profiles); err != nil {
+			log.Fatalf("Failed to import the driver profiles: %v", err)
+		}
+		log.Printf("Imported %d driver profiles from %s", len(profiles), profilesFile)
+	}
 
 	// RabbitMQ connection
+	messaging.Producer = "driver-service"
 	rabbitmq, err := messaging.NewRabbitMQ(rabbitMqURI)
 	if err != nil {
 		log.Fatal(err)
@@ -59,16 +100,48 @@ func main() {
 	log.Println("Starting RabbitMQ connection")
 
 	// Starting the gRPC server
-	grpcServer := grpcserver.NewServer(tracing.WithTracingInterceptors()...)
+	// The handlers check the identity of the user the gateway authenticated
+	serverOptions := append(tracing.WithTracingInterceptors(), auth.WithIdentityInterceptors()...)
+	grpcServer := grpcserver.NewServer(serverOptions...)
 	NewGrpcHandler(grpcServer, svc)
 
-	consumer := NewTripConsumer(rabbitmq, svc)
+	// Report the RabbitMQ connection through the gRPC health check, consumers stop while it is down
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	rabbitmq.OnReadinessChange(func(ready bool) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if ready {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		healthServer.SetServingStatus("", status)
+	})
+
+	dispatchCfg := DefaultDispatchConfig()
+	dispatchCfg.OfferTimeout = time.Duration(env.GetInt("DISPATCH_OFFER_TIMEOUT_SECONDS", int(dispatchCfg.OfferTimeout.Seconds()))) * time.Second
+	dispatchCfg.MaxAttempts = env.GetInt("DISPATCH_MAX_ATTEMPTS", dispatchCfg.MaxAttempts)
+	dispatchCfg.TotalTimeout = time.Duration(env.GetInt("DISPATCH_TOTAL_TIMEOUT_SECONDS", int(dispatchCfg.TotalTimeout.Seconds()))) * time.Second
+
+	dispatcher := NewDispatcher(rabbitmq, svc, NewMongoDispatchStore(mongoDb), dispatchCfg)
+	go dispatcher.Run(ctx)
+
+	// Redelivered messages are skipped by the consumers, the processed message IDs are shared by the replicas
+	inbox := messaging.NewMongoInboxStore(mongoDb, time.Duration(env.GetInt("INBOX_RETENTION_HOURS", 24))*time.Hour)
+	if err := inbox.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create the inbox indexes: %v", err)
+	}
+
+	consumer := NewTripConsumer(rabbitmq, svc, dispatcher, inbox)
 	go func() {
 		if err := consumer.Listen(); err != nil {
 			log.Fatalf("Failed to listen to the message: %v", err)
 		}
 	}()
 
+	locationConsumer := NewLocationConsumer(rabbitmq, svc)
+	if err := locationConsumer.Listen(); err != nil {
+		log.Fatalf("Failed to listen to the location updates: %v", err)
+	}
+
 	log.Printf("Starting gRPC server Driver service on port %s", lis.Addr().String())
 
 	go func() {
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrInvalidProfile = errors.New("invalid driver profile")
+
+// LoadProfiles reads the profiles of the onboarded drivers from a JSON file holding an array of profiles:
+//
+//	[{"id": "driver-1", "name": "Lando Norris", "carPlate": "AB123CD", "vehicle": "Toyota Prius", "approvedPackages": ["sedan"]}]
+func LoadProfiles(path string) ([]*DriverProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the driver profiles file: %w", err)
+	}
+
+	var profiles []*DriverProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse the driver profiles file: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// ImportProfiles onboards the drivers, or updates the profiles of the drivers already onboarded. The
+// sessions of the online drivers pick up the new profile when they register again.
+func (s *Service) ImportProfiles(ctx context.Context, profiles []*DriverProfile) error {
+	for i, profile := range profiles {
+		if err := validateProfile(profile); err != nil {
+			return fmt.Errorf("profile %d: %w", i, err)
+		}
+	}
+
+	for _, profile := range profiles {
+		if err := s.repo.SaveProfile(ctx, profile); err != nil {
+			return fmt.Errorf("failed to save the profile of driver %s: %w", profile.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func validateProfile(profile *DriverProfile) error {
+	if profile == nil || profile.ID == "" {
+		return fmt.Errorf("%w: no driver ID", ErrInvalidProfile)
+	}
+
+	if profile.Name == "" {
+		return fmt.Errorf("%w: driver %s has no name", ErrInvalidProfile, profile.ID)
+	}
+
+	if len(profile.ApprovedPackages) == 0 {
+		return fmt.Errorf("%w: driver %s is approved for no package", ErrInvalidProfile, profile.ID)
+	}
+
+	return nil
+}
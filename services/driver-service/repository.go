@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	pb "ride-sharing/shared/proto/driver"
+	"ride-sharing/shared/types"
+	"time"
+)
+
+// DriverProfile is the long lived identity of a driver, managed outside of their online sessions
+type DriverProfile struct {
+	ID               string   `bson:"_id" json:"id"`
+	Name             string   `bson:"name" json:"name"`
+	ProfilePicture   string   `bson:"profilePicture" json:"profilePicture"`
+	CarPlate         string   `bson:"carPlate" json:"carPlate"`
+	Vehicle          string   `bson:"vehicle" json:"vehicle"`                   // ex: Toyota Prius (white)
+	ApprovedPackages []string `bson:"approvedPackages" json:"approvedPackages"` // the packages the driver is allowed to drive for
+}
+
+// IsApprovedFor reports whether the driver may go online for the package
+func (p *DriverProfile) IsApprovedFor(packageSlug string) bool {
+	for _, slug := range p.ApprovedPackages {
+		if slug == packageSlug {
+			return true
+		}
+	}
+	return false
+}
+
+// DriverSession is a driver who is currently connected, from registration until they disconnect
+type DriverSession struct {
+	DriverID    string            `bson:"_id"`
+	PackageSlug string            `bson:"packageSlug"`
+	Status      DriverStatus      `bson:"status"`
+	TripID      string            `bson:"tripID"`  // the trip the driver is currently offered or assigned to, if any
+	RiderID     string            `bson:"riderID"` // the rider of an assigned trip
+	Location    *types.Coordinate `bson:"location"`
+	Geohash     string            `bson:"geohash"`
+	Cell        string            `bson:"cell"`      // geohash of the matching cell, see geoIndexPrecision
+	Profile     *DriverProfile    `bson:"profile"`   // snapshot of the profile, taken again every time the driver registers
+	UpdatedAt   time.Time         `bson:"updatedAt"` // refreshed by every change and by the gateway heartbeat
+}
+
+// SessionConfig controls what happens to the session of a driver who is no longer heard from, after
+// the gateway holding their connection crashed for instance. The gateway registers its connected drivers
+// again periodically, which refreshes their session.
+type SessionConfig struct {
+	StaleAfter time.Duration // online drivers not heard from for this long are not offered trips anymore
+	TTL        time.Duration // sessions not heard from for this long are deleted, a driver serving a trip can reconnect within it
+}
+
+func DefaultSessionConfig() *SessionConfig {
+	return &SessionConfig{
+		StaleAfter: 90 * time.Second,
+		TTL:        10 * time.Minute,
+	}
+}
+
+func (s *DriverSession) ToProto() *pb.Driver {
+	driver := &pb.Driver{
+		Id:          s.DriverID,
+		Geohash:     s.Geohash,
+		PackageSlug: s.PackageSlug,
+		Status:      string(s.Status),
+	}
+
+	if s.Location != nil {
+		driver.Location = &pb.Location{Latitude: s.Location.Latitude, Longitude: s.Location.Longitude}
+	}
+
+	if s.Profile != nil {
+		driver.Name = s.Profile.Name
+		driver.ProfilePicture = s.Profile.ProfilePicture
+		driver.CarPlate = s.Profile.CarPlate
+		driver.Vehicle = s.Profile.Vehicle
+	}
+
+	return driver
+}
+
+// statusChange moves a session to Status, as long as it is currently in one of From (any status if empty)
+// and, when MatchTripID is set, holds that trip.
+type statusChange struct {
+	From        []DriverStatus
+	MatchTripID string
+	Status      DriverStatus
+	TripID      string
+	RiderID     string
+}
+
+type DriverRepository interface {
+	// GetProfile returns nil if the driver has no profile
+	GetProfile(ctx context.Context, driverID string) (*DriverProfile, error)
+	SaveProfile(ctx context.Context, profile *DriverProfile) error
+
+	// StartSession saves the session of a driver coming online and returns it. A driver who still has one,
+	// after a reconnect, keeps its status, trip and location: only the package and the profile are refreshed.
+	StartSession(ctx context.Context, session *DriverSession) (*DriverSession, error)
+	// GetSession returns nil if the driver is not connected
+	GetSession(ctx context.Context, driverID string) (*DriverSession, error)
+	// DeleteSession deletes the session of the driver if it is in one of the statuses
+	DeleteSession(ctx context.Context, driverID string, statuses ...DriverStatus) error
+	// FindOnlineSessions returns the online sessions of the package located in one of the cells,
+	// or anywhere if cells is nil. Stale sessions are left out.
+	FindOnlineSessions(ctx context.Context, packageSlug string, cells []string) ([]*DriverSession, error)
+	// CountOnlineSessions counts the online sessions of every package whose cell starts with the geohash,
+	// stale sessions left out
+	CountOnlineSessions(ctx context.Context, geohash string) (int, error)
+	// UpdateSessionStatus applies the change atomically. It returns nil if the session doesn't match.
+	UpdateSessionStatus(ctx context.Context, driverID string, change statusChange) (*DriverSession, error)
+	// UpdateSessionLocation returns nil if the driver is not connected
+	UpdateSessionLocation(ctx context.Context, driverID string, location *types.Coordinate, geohash, cell string) (*DriverSession, error)
+}
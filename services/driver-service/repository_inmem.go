@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"ride-sharing/shared/types"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inmemDriverRepository keeps the sessions in this process. Stale sessions are only left out of the searches,
+// they are replaced when the driver registers after the TTL or deleted when they disconnect.
+type inmemDriverRepository struct {
+	cfg      *SessionConfig
+	profiles map[string]*DriverProfile
+	sessions map[string]*DriverSession
+	mu       sync.RWMutex
+}
+
+func NewInmemDriverRepository(cfg *SessionConfig) *inmemDriverRepository {
+	return &inmemDriverRepository{
+		cfg:      cfg,
+		profiles: make(map[string]*DriverProfile),
+		sessions: make(map[string]*DriverSession),
+	}
+}
+
+func (r *inmemDriverRepository) isFresh(session *DriverSession, now time.Time) bool {
+	return now.Sub(session.UpdatedAt) <= r.cfg.StaleAfter
+}
+
+func (r *inmemDriverRepository) GetProfile(ctx context.Context, driverID string) (*DriverProfile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profile, ok := r.profiles[driverID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *profile
+	return &copied, nil
+}
+
+func (r *inmemDriverRepository) SaveProfile(ctx context.Context, profile *DriverProfile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := *profile
+	r.profiles[profile.ID] = &copied
+	return nil
+}
+
+func (r *inmemDriverRepository) StartSession(ctx context.Context, session *DriverSession) (*DriverSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.sessions[session.DriverID]; ok && session.UpdatedAt.Sub(existing.UpdatedAt) <= r.cfg.TTL {
+		existing.PackageSlug = session.PackageSlug
+		existing.Profile = session.Profile
+		existing.UpdatedAt = session.UpdatedAt
+
+		copied := *existing
+		return &copied, nil
+	}
+
+	copied := *session
+	r.sessions[session.DriverID] = &copied
+	return session, nil
+}
+
+func (r *inmemDriverRepository) GetSession(ctx context.Context, driverID string) (*DriverSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[driverID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+func (r *inmemDriverRepository) DeleteSession(ctx context.Context, driverID string, statuses ...DriverStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[driverID]; ok && slices.Contains(statuses, session.Status) {
+		delete(r.sessions, driverID)
+	}
+	return nil
+}
+
+func (r *inmemDriverRepository) FindOnlineSessions(ctx context.Context, packageSlug string, cells []string) ([]*DriverSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+
+	var sessions []*DriverSession
+	for _, session := range r.sessions {
+		if session.Status != DriverStatusOnline || session.PackageSlug != packageSlug || !r.isFresh(session, now) {
+			continue
+		}
+
+		if cells != nil && !slices.Contains(cells, session.Cell) {
+			continue
+		}
+
+		copied := *session
+		sessions = append(sessions, &copied)
+	}
+
+	return sessions, nil
+}
+
+func (r *inmemDriverRepository) CountOnlineSessions(ctx context.Context, geohash string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+
+	count := 0
+	for _, session := range r.sessions {
+		if session.Status == DriverStatusOnline && strings.HasPrefix(session.Cell, geohash) && r.isFresh(session, now) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *inmemDriverRepository) UpdateSessionStatus(ctx context.Context, driverID string, change statusChange) (*DriverSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[driverID]
+	if !ok {
+		return nil, nil
+	}
+
+	if len(change.From) > 0 && !slices.Contains(change.From, session.Status) {
+		return nil, nil
+	}
+
+	if change.MatchTripID != "" && session.TripID != change.MatchTripID {
+		return nil, nil
+	}
+
+	session.Status = change.Status
+	session.TripID = change.TripID
+	session.RiderID = change.RiderID
+	session.UpdatedAt = time.Now()
+
+	copied := *session
+	return &copied, nil
+}
+
+func (r *inmemDriverRepository) UpdateSessionLocation(ctx context.Context, driverID string, location *types.Coordinate, geohash, cell string) (*DriverSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[driverID]
+	if !ok {
+		return nil, nil
+	}
+
+	session.Location = location
+	session.Geohash = geohash
+	session.Cell = cell
+	session.UpdatedAt = time.Now()
+
+	copied := *session
+	return &copied, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"ride-sharing/shared/db"
+	"ride-sharing/shared/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoDriverRepository struct {
+	db  *mongo.Database
+	cfg *SessionConfig
+}
+
+func NewMongoDriverRepository(db *mongo.Database, cfg *SessionConfig) *mongoDriverRepository {
+	return &mongoDriverRepository{db: db, cfg: cfg}
+}
+
+// EnsureIndexes creates the indexes of the driver sessions: the expiry of the sessions no longer heard
+// from, and the ones of the driver searches
+func (r *mongoDriverRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.db.Collection(db.DriverSessionsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(r.cfg.TTL.Seconds())),
+		},
+		{
+			// FindOnlineSessions
+			Keys: bson.D{{Key: "packageSlug", Value: 1}, {Key: "status", Value: 1}, {Key: "cell", Value: 1}},
+		},
+		{
+			// CountOnlineSessions, by cell prefix
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "cell", Value: 1}},
+		},
+	})
+	return err
+}
+
+// freshSince is the oldest update of a session that is not stale
+func (r *mongoDriverRepository) freshSince() time.Time {
+	return time.Now().Add(-r.cfg.StaleAfter)
+}
+
+func (r *mongoDriverRepository) GetProfile(ctx context.Context, driverID string) (*DriverProfile, error) {
+	result := r.db.Collection(db.DriverProfilesCollection).FindOne(ctx, bson.M{"_id": driverID})
+	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, result.Err()
+	}
+
+	var profile DriverProfile
+	if err := result.Decode(&profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (r *mongoDriverRepository) SaveProfile(ctx context.Context, profile *DriverProfile) error {
+	_, err := r.db.Collection(db.DriverProfilesCollection).ReplaceOne(
+		ctx,
+		bson.M{"_id": profile.ID},
+		profile,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *mongoDriverRepository) StartSession(ctx context.Context, session *DriverSession) (*DriverSession, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"packageSlug": session.PackageSlug,
+			"profile":     session.Profile,
+			"updatedAt":   session.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"status":   session.Status,
+			"tripID":   session.TripID,
+			"riderID":  session.RiderID,
+			"location": session.Location,
+			"geohash":  session.Geohash,
+			"cell":     session.Cell,
+		},
+	}
+
+	result := r.db.Collection(db.DriverSessionsCollection).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": session.DriverID},
+		update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+	return decodeSession(result)
+}
+
+func (r *mongoDriverRepository) GetSession(ctx context.Context, driverID string) (*DriverSession, error) {
+	result := r.db.Collection(db.DriverSessionsCollection).FindOne(ctx, bson.M{"_id": driverID})
+	return decodeSession(result)
+}
+
+func (r *mongoDriverRepository) DeleteSession(ctx context.Context, driverID string, statuses ...DriverStatus) error {
+	_, err := r.db.Collection(db.DriverSessionsCollection).DeleteOne(ctx, bson.M{
+		"_id":    driverID,
+		"status": bson.M{"$in": statuses},
+	})
+	return err
+}
+
+func (r *mongoDriverRepository) FindOnlineSessions(ctx context.Context, packageSlug string, cells []string) ([]*DriverSession, error) {
+	filter := bson.M{
+		"packageSlug": packageSlug,
+		"status":      DriverStatusOnline,
+		"updatedAt":   bson.M{"$gte": r.freshSince()},
+	}
+
+	if cells != nil {
+		filter["cell"] = bson.M{"$in": cells}
+	}
+
+	cursor, err := r.db.Collection(db.DriverSessionsCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*DriverSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *mongoDriverRepository) CountOnlineSessions(ctx context.Context, geohash string) (int, error) {
+	count, err := r.db.Collection(db.DriverSessionsCollection).CountDocuments(ctx, bson.M{
+		"status":    DriverStatusOnline,
+		"cell":      bson.M{"$regex": "^" + regexp.QuoteMeta(geohash)},
+		"updatedAt": bson.M{"$gte": r.freshSince()},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func (r *mongoDriverRepository) UpdateSessionStatus(ctx context.Context, driverID string, change statusChange) (*DriverSession, error) {
+	filter := bson.M{"_id": driverID}
+
+	if len(change.From) > 0 {
+		filter["status"] = bson.M{"$in": change.From}
+	}
+
+	if change.MatchTripID != "" {
+		filter["tripID"] = change.MatchTripID
+	}
+
+	update := bson.M{"$set": bson.M{
+		"status":    change.Status,
+		"tripID":    change.TripID,
+		"riderID":   change.RiderID,
+		"updatedAt": time.Now(),
+	}}
+
+	result := r.db.Collection(db.DriverSessionsCollection).FindOneAndUpdate(
+		ctx,
+		filter,
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	return decodeSession(result)
+}
+
+func (r *mongoDriverRepository) UpdateSessionLocation(ctx context.Context, driverID string, location *types.Coordinate, geohash, cell string) (*DriverSession, error) {
+	update := bson.M{"$set": bson.M{
+		"location":  location,
+		"geohash":   geohash,
+		"cell":      cell,
+		"updatedAt": time.Now(),
+	}}
+
+	result := r.db.Collection(db.DriverSessionsCollection).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": driverID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	return decodeSession(result)
+}
+
+// decodeSession returns nil if the query matched no session
+func decodeSession(result *mongo.SingleResult) (*DriverSession, error) {
+	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, result.Err()
+	}
+
+	var session DriverSession
+	if err := result.Decode(&session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
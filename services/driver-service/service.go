@@ -1,84 +1,298 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	math "math/rand/v2"
 	pb "ride-sharing/shared/proto/driver"
-	"ride-sharing/shared/util"
-	"sync"
+	"ride-sharing/shared/types"
+	"sort"
+	"time"
 
 	"github.com/mmcloughlin/geohash"
 )
 
-type driverInMap struct {
-	Driver *pb.Driver
-	// Index int
-	// TODO: route
+var (
+	ErrPackageNotApproved = errors.New("driver is not approved for this package")
+	ErrInvalidGeohash     = errors.New("geohash must be between 1 and 6 characters long")
+)
+
+// MatchingConfig controls which drivers are considered for a trip
+type MatchingConfig struct {
+	SearchRadiusKm  float64 // drivers further away from the pickup are never matched
+	MaxCandidates   int
+	AverageSpeedKmh float64 // used to estimate the pickup ETA
+}
+
+func DefaultMatchingConfig() *MatchingConfig {
+	return &MatchingConfig{
+		SearchRadiusKm:  5,
+		MaxCandidates:   10,
+		AverageSpeedKmh: 30,
+	}
+}
+
+// driverCandidate is an available driver ranked for a trip
+type driverCandidate struct {
+	DriverID   string
+	DistanceKm float64
+	PickupETA  time.Duration
 }
 
 type Service struct {
-	drivers []*driverInMap
-	mu      sync.RWMutex
+	repo     DriverRepository
+	matching *MatchingConfig
+	// demoProfiles creates a profile for unknown drivers instead of refusing them, for local development
+	demoProfiles bool
 }
 
-func NewService() *Service {
+func NewService(repo DriverRepository, matching *MatchingConfig, demoProfiles bool) *Service {
 	return &Service{
-		drivers: make([]*driverInMap, 0),
+		repo:         repo,
+		matching:     matching,
+		demoProfiles: demoProfiles,
 	}
 }
 
-func (s *Service) FindAvailableDrivers(packageType string) []string {
-	var matchingDrivers []string
+// FindAvailableDrivers returns the idle drivers of the package closest to the pickup, nearest first.
+// Without a pickup location every idle driver of the package is returned.
+func (s *Service) FindAvailableDrivers(ctx context.Context, packageType string, pickup *types.Coordinate) ([]driverCandidate, error) {
+	if pickup == nil {
+		sessions, err := s.repo.FindOnlineSessions(ctx, packageType, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	for _, driver := range s.drivers {
-		if driver.Driver.PackageSlug == packageType {
-			matchingDrivers = append(matchingDrivers, driver.Driver.Id)
+		candidates := make([]driverCandidate, 0, len(sessions))
+		for _, session := range sessions {
+			candidates = append(candidates, driverCandidate{DriverID: session.DriverID})
 		}
+		return candidates, nil
+	}
+
+	cells := cellsWithin(pickup.Latitude, pickup.Longitude, s.matching.SearchRadiusKm)
+
+	sessions, err := s.repo.FindOnlineSessions(ctx, packageType, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []driverCandidate
+	for _, session := range sessions {
+		if session.Location == nil {
+			continue
+		}
+
+		distance := haversineKm(pickup.Latitude, pickup.Longitude, session.Location.Latitude, session.Location.Longitude)
+		if distance > s.matching.SearchRadiusKm {
+			continue
+		}
+
+		candidates = append(candidates, driverCandidate{
+			DriverID:   session.DriverID,
+			DistanceKm: distance,
+			PickupETA:  time.Duration(distance / s.matching.AverageSpeedKmh * float64(time.Hour)),
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].DistanceKm < candidates[j].DistanceKm
+	})
+
+	if len(candidates) > s.matching.MaxCandidates {
+		candidates = candidates[:s.matching.MaxCandidates]
 	}
 
-	if len(matchingDrivers) == 0 {
-		return []string{}
+	return candidates, nil
+}
+
+// CountAvailableDrivers returns how many drivers are online in the geohash area, whatever their package
+func (s *Service) CountAvailableDrivers(ctx context.Context, area string) (int, error) {
+	if len(area) == 0 || len(area) > geoIndexPrecision {
+		return 0, ErrInvalidGeohash
 	}
 
-	return matchingDrivers
+	return s.repo.CountOnlineSessions(ctx, area)
 }
 
-func (s *Service) RegisterDriver(driverId string, packageSlug string) (*pb.Driver, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// RegisterDriver starts an online session for the driver, using their stored profile. A driver reconnecting
+// in the middle of an offer or a trip resumes it.
+func (s *Service) RegisterDriver(ctx context.Context, driverId string, packageSlug string) (*pb.Driver, error) {
+	profile, err := s.repo.GetProfile(ctx, driverId)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile == nil {
+		if !s.demoProfiles {
+			return nil, fmt.Errorf("%w: %s", ErrDriverNotFound, driverId)
+		}
 
-	randomIndex := math.IntN(len(PredefinedRoutes))
-	randomRoute := PredefinedRoutes[randomIndex]
+		profile = NewDemoProfile(driverId)
+		if err := s.repo.SaveProfile(ctx, profile); err != nil {
+			return nil, err
+		}
+	}
 
-	randomPlate := GenerateRandomPlate()
-	randomAvatar := util.GetRandomAvatar(randomIndex)
+	if !profile.IsApprovedFor(packageSlug) {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotApproved, packageSlug)
+	}
 
-	// we can ignore this property for now, but it must be sent to the frontend.
-	geohash := geohash.Encode(randomRoute[0][0], randomRoute[0][1])
+	// Drivers start at the beginning of one of the predefined routes
+	randomRoute := PredefinedRoutes[math.IntN(len(PredefinedRoutes))]
+	location := &types.Coordinate{Latitude: randomRoute[0][0], Longitude: randomRoute[0][1]}
 
-	driver := &pb.Driver{
-		Id:             driverId,
-		Geohash:        geohash,
-		Location:       &pb.Location{Latitude: randomRoute[0][0], Longitude: randomRoute[0][1]},
-		Name:           "Lando Norris",
-		PackageSlug:    packageSlug,
-		ProfilePicture: randomAvatar,
-		CarPlate:       randomPlate,
+	session := &DriverSession{
+		DriverID:    driverId,
+		PackageSlug: packageSlug,
+		Status:      DriverStatusOnline,
+		Location:    location,
+		Geohash:     geohash.Encode(location.Latitude, location.Longitude),
+		Cell:        cellOf(location.Latitude, location.Longitude),
+		Profile:     profile,
+		UpdatedAt:   time.Now(),
 	}
 
-	s.drivers = append(s.drivers, &driverInMap{
-		Driver: driver,
-	})
+	session, err = s.repo.StartSession(ctx, session)
+	if err != nil {
+		return nil, err
+	}
 
-	return driver, nil
+	return session.ToProto(), nil
 }
 
-func (s *Service) UnregisterDriver(driverId string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
-	for i, driver := range s.drivers {
-		if driver.Driver.Id == driverId {
-			s.drivers = append(s.drivers[:i], s.drivers[i+1:]...)
+// UnregisterDriver ends the session of a disconnected driver. A driver serving a trip keeps it,
+// so they resume the trip when they reconnect.
+func (s *Service) UnregisterDriver(ctx context.Context, driverId string) error {
+	return s.repo.DeleteSession(ctx, driverId, DriverStatusOnline, DriverStatusOffered, DriverStatusOffline)
+}
+
+// SetStatus lets a driver go on a break or come back from one. Drivers who are offered or
+// serving a trip cannot change their status.
+func (s *Service) SetStatus(ctx context.Context, driverId string, status DriverStatus) (*pb.Driver, error) {
+	if status != DriverStatusOnline && status != DriverStatusOffline {
+		return nil, ErrInvalidDriverStatus
+	}
+
+	session, err := s.repo.UpdateSessionStatus(ctx, driverId, statusChange{
+		From:   []DriverStatus{DriverStatusOnline, DriverStatusOffline},
+		Status: status,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		current, err := s.repo.GetSession(ctx, driverId)
+		if err != nil {
+			return nil, err
 		}
+
+		if current == nil {
+			return nil, ErrDriverNotFound
+		}
+
+		return nil, ErrDriverBusy
+	}
+
+	return session.ToProto(), nil
+}
+
+// OfferTrip reserves an online driver for the trip while they decide whether to take it
+func (s *Service) OfferTrip(ctx context.Context, driverId string, tripID string) error {
+	session, err := s.repo.UpdateSessionStatus(ctx, driverId, statusChange{
+		From:   []DriverStatus{DriverStatusOnline},
+		Status: DriverStatusOffered,
+		TripID: tripID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if session == nil {
+		return ErrDriverBusy
+	}
+
+	return nil
+}
+
+// GetOffer returns the driver if they currently hold the offer of the trip
+func (s *Service) GetOffer(ctx context.Context, driverId string, tripID string) (*pb.Driver, error) {
+	session, err := s.repo.GetSession(ctx, driverId)
+	if err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrDriverNotFound
+	}
+
+	if session.Status != DriverStatusOffered || session.TripID != tripID {
+		return nil, ErrNoOffer
+	}
+
+	return session.ToProto(), nil
+}
+
+// ReleaseOffer makes the driver available again if they are still holding the offer for the trip
+func (s *Service) ReleaseOffer(ctx context.Context, driverId string, tripID string) error {
+	_, err := s.repo.UpdateSessionStatus(ctx, driverId, statusChange{
+		From:        []DriverStatus{DriverStatusOffered},
+		MatchTripID: tripID,
+		Status:      DriverStatusOnline,
+	})
+	return err
+}
+
+// AssignTrip marks the driver as driving to the pickup of the given trip
+func (s *Service) AssignTrip(ctx context.Context, driverId string, tripID string, riderID string) error {
+	_, err := s.repo.UpdateSessionStatus(ctx, driverId, statusChange{
+		Status:  DriverStatusEnRoute,
+		TripID:  tripID,
+		RiderID: riderID,
+	})
+	return err
+}
+
+// StartTrip marks the driver as having the rider of the given trip on board
+func (s *Service) StartTrip(ctx context.Context, driverId string, tripID string, riderID string) error {
+	_, err := s.repo.UpdateSessionStatus(ctx, driverId, statusChange{
+		From:        []DriverStatus{DriverStatusEnRoute},
+		MatchTripID: tripID,
+		Status:      DriverStatusOnTrip,
+		TripID:      tripID,
+		RiderID:     riderID,
+	})
+	return err
+}
+
+// ReleaseDriver frees the driver from the given trip so they can be offered new ones
+func (s *Service) ReleaseDriver(ctx context.Context, driverId string, tripID string) error {
+	_, err := s.repo.UpdateSessionStatus(ctx, driverId, statusChange{
+		MatchTripID: tripID,
+		Status:      DriverStatusOnline,
+	})
+	return err
+}
+
+// UpdateLocation moves the driver to the new position. It returns the updated driver
+// and the rider of the trip they are assigned to, if any.
+func (s *Service) UpdateLocation(ctx context.Context, driverId string, location *types.Coordinate) (*pb.Driver, string, error) {
+	session, err := s.repo.UpdateSessionLocation(
+		ctx,
+		driverId,
+		location,
+		geohash.Encode(location.Latitude, location.Longitude),
+		cellOf(location.Latitude, location.Longitude),
+	)
+	if err != nil {
+		return nil, "", err
 	}
-}
\ No newline at end of file
+
+	if session == nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrDriverNotFound, driverId)
+	}
+
+	return session.ToProto(), session.RiderID, nil
+}
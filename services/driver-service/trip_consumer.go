@@ -2,89 +2,88 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
-	"math/rand"
 	"ride-sharing/shared/contracts"
 	"ride-sharing/shared/messaging"
-
-	"github.com/rabbitmq/amqp091-go"
 )
 
 type tripConsumer struct {
-	rabbitmq *messaging.RabbitMQ
-	service  *Service
+	rabbitmq   *messaging.RabbitMQ
+	service    *Service
+	dispatcher *dispatcher
+	inbox      messaging.InboxStore
 }
 
-func NewTripConsumer(rabbitmq *messaging.RabbitMQ, service *Service) *tripConsumer {
+func NewTripConsumer(rabbitmq *messaging.RabbitMQ, service *Service, dispatcher *dispatcher, inbox messaging.InboxStore) *tripConsumer {
 	return &tripConsumer{
-		rabbitmq: rabbitmq,
-		service:  service,
+		rabbitmq:   rabbitmq,
+		service:    service,
+		dispatcher: dispatcher,
+		inbox:      inbox,
 	}
 }
 
 func (c *tripConsumer) Listen() error {
-	return c.rabbitmq.ConsumeMessages(messaging.FindAvailableDriversQueue, func(ctx context.Context, msg amqp091.Delivery) error {
-		var tripEvent contracts.AmqpMessage
-		if err := json.Unmarshal(msg.Body, &tripEvent); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			return err
-		}
-
-		var payload messaging.TripEventData
-		if err := json.Unmarshal(tripEvent.Data, &payload); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			return err
-		}
-
-		log.Printf("driver received message: %+v", payload)
+	if err := c.listenTripUpdates(); err != nil {
+		return err
+	}
 
-		switch msg.RoutingKey {
-		case contracts.TripEventCreated, contracts.TripEventDriverNotInterested:
-			return c.handleFindAndNotifyDrivers(ctx, payload)
-		}
+	router := messaging.NewRouter()
+	router.UseInbox(c.inbox)
 
-		log.Printf("unknown trip event: %+v", payload)
+	messaging.On(router, contracts.TripEventCreated, func(ctx context.Context, e *messaging.Event[messaging.TripEventData]) error {
+		log.Printf("driver received message: %+v", e.Payload)
+		return c.dispatcher.Start(ctx, e.Payload)
+	})
 
-		return nil
+	messaging.On(router, contracts.TripEventDriverNotInterested, func(ctx context.Context, e *messaging.Event[messaging.TripEventData]) error {
+		log.Printf("driver received message: %+v", e.Payload)
+		return c.dispatcher.Decline(ctx, e.Payload.Trip.Id, e.Payload.DriverID)
 	})
-}
 
-func (c *tripConsumer) handleFindAndNotifyDrivers(ctx context.Context, payload messaging.TripEventData) error {
-	suitableIDs := c.service.FindAvailableDrivers(payload.Trip.SelectedFare.PackageSlug)
+	return c.rabbitmq.ConsumeEvents(messaging.FindAvailableDriversQueue, router)
+}
 
-	log.Printf("Found suitable drivers %v", len(suitableIDs))
+// listenTripUpdates keeps the drivers' availability in sync with the trip lifecycle
+func (c *tripConsumer) listenTripUpdates() error {
+	router := messaging.NewRouter()
+	router.UseInbox(c.inbox)
+
+	handleUpdate := func(ctx context.Context, e *messaging.Event[messaging.TripEventData]) error {
+		trip := e.Payload.Trip
+
+		if driverID := trip.GetDriver().GetId(); driverID != "" {
+			var err error
+			switch e.EventType {
+			case contracts.TripEventDriverAssigned:
+				err = c.service.AssignTrip(ctx, driverID, trip.Id, trip.UserID)
+			case contracts.TripEventStarted:
+				err = c.service.StartTrip(ctx, driverID, trip.Id, trip.UserID)
+			case contracts.TripEventCancelled, contracts.TripEventCompleted:
+				err = c.service.ReleaseDriver(ctx, driverID, trip.Id)
+				log.Printf("Driver %s released from trip %s", driverID, trip.Id)
+			}
+
+			if err != nil {
+				log.Printf("Failed to update driver %s for trip %s: %v", driverID, trip.Id, err)
+				return err
+			}
+		}
 
-	if len(suitableIDs) == 0 {
-		// Notify the driver that no drivers are available
-		if err := c.rabbitmq.PublishMessage(ctx, contracts.TripEventNoDriversFound, contracts.AmqpMessage{
-			OwnerID: payload.Trip.UserID,
-		}); err != nil {
-			log.Printf("Failed to publish message to exchange: %v", err)
-			return err
+		// Once a driver is assigned or the trip is cancelled there is nothing left to dispatch
+		if e.EventType == contracts.TripEventDriverAssigned || e.EventType == contracts.TripEventCancelled {
+			return c.dispatcher.Finish(ctx, trip.Id)
 		}
 
 		return nil
 	}
 
-	// Get a random index from the matching drivers
-	randomIndex := rand.Intn(len(suitableIDs))
-
-	suitableDriverID := suitableIDs[randomIndex]
-
-	marshalledEvent, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
-
-	// Notify the driver about a potential trip
-	if err := c.rabbitmq.PublishMessage(ctx, contracts.DriverCmdTripRequest, contracts.AmqpMessage{
-		OwnerID: suitableDriverID,
-		Data:    marshalledEvent,
-	}); err != nil {
-		log.Printf("Failed to publish message to exchange: %v", err)
-		return err
+	for _, key := range []string{
+		contracts.TripEventDriverAssigned, contracts.TripEventStarted, contracts.TripEventCancelled,
+		contracts.TripEventCompleted,
+	} {
+		messaging.On(router, key, handleUpdate)
 	}
 
-	return nil
+	return c.rabbitmq.ConsumeEvents(messaging.DriverTripUpdatesQueue, router)
 }
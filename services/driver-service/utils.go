@@ -1,6 +1,9 @@
 package main
 
-import "math/rand"
+import (
+	"math/rand"
+	"ride-sharing/shared/util"
+)
 
 // Predefined routes for drivers (used for the gRPC Streaming module)
 // (these are San Francisco routes, get these coordinates from Google Maps for example and build a custom route if you want)
@@ -54,4 +57,25 @@ func GenerateRandomPlate() string {
 	}
 
 	return plate
-}
\ No newline at end of file
+}
+
+var (
+	demoNames    = []string{"Lando Norris", "Oscar Piastri", "Charles Leclerc", "George Russell", "Alex Albon"}
+	demoVehicles = []string{"Toyota Prius", "Tesla Model 3", "Ford Transit", "Mercedes S-Class"}
+	// demoPackages are the packages a demo driver is approved for
+	demoPackages = []string{"sedan", "suv", "van", "luxury"}
+)
+
+// NewDemoProfile generates a profile for a driver who was never onboarded, used in local development
+func NewDemoProfile(driverID string) *DriverProfile {
+	index := rand.Intn(len(demoNames))
+
+	return &DriverProfile{
+		ID:               driverID,
+		Name:             demoNames[index],
+		ProfilePicture:   util.GetRandomAvatar(index),
+		CarPlate:         GenerateRandomPlate(),
+		Vehicle:          demoVehicles[rand.Intn(len(demoVehicles))],
+		ApprovedPackages: demoPackages,
+	}
+}
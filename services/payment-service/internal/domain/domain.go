@@ -11,5 +11,12 @@ type Service interface {
 }
 
 type PaymentProcessor interface {
-	CreatePaymentSession(ctx context.Context, amount int64, currency string, metadata map[string]string) (string, error)
+	// CreatePaymentSession creates the checkout session of a trip. Calls for the same trip return the same
+	// session, the repository doesn't know of the sessions created before a restart.
+	CreatePaymentSession(ctx context.Context, tripID string, amount int64, currency string, metadata map[string]string) (string, error)
+}
+
+type Repository interface {
+	SavePaymentIntent(ctx context.Context, intent *types.PaymentIntent) error
+	GetPaymentIntentByTripID(ctx context.Context, tripID string) (*types.PaymentIntent, error)
 }
@@ -2,52 +2,40 @@ package events
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 
 	"ride-sharing/services/payment-service/internal/domain"
 	"ride-sharing/shared/contracts"
 	"ride-sharing/shared/messaging"
-
-	"github.com/rabbitmq/amqp091-go"
 )
 
 type TripConsumer struct {
 	rabbitmq *messaging.RabbitMQ
 	service  domain.Service
+	inbox    messaging.InboxStore
 }
 
-func NewTripConsumer(rabbitmq *messaging.RabbitMQ, service domain.Service) *TripConsumer {
+func NewTripConsumer(rabbitmq *messaging.RabbitMQ, service domain.Service, inbox messaging.InboxStore) *TripConsumer {
 	return &TripConsumer{
 		rabbitmq: rabbitmq,
 		service:  service,
+		inbox:    inbox,
 	}
 }
 
 func (c *TripConsumer) Listen() error {
-	return c.rabbitmq.ConsumeMessages(messaging.PaymentTripResponseQueue, func(ctx context.Context, msg amqp091.Delivery) error {
-		var message contracts.AmqpMessage
-		if err := json.Unmarshal(msg.Body, &message); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			return err
-		}
+	router := messaging.NewRouter()
+	router.UseInbox(c.inbox)
 
-		var payload messaging.PaymentTripResponseData
-		if err := json.Unmarshal(message.Data, &payload); err != nil {
-			log.Printf("Failed to unmarshal payload: %v", err)
+	messaging.On(router, contracts.PaymentCmdCreateSession, func(ctx context.Context, e *messaging.Event[messaging.PaymentTripResponseData]) error {
+		if err := c.handleTripAccepted(ctx, e.Payload); err != nil {
+			log.Printf("Failed to handle trip accepted: %v", err)
 			return err
 		}
-
-		switch msg.RoutingKey {
-		case contracts.PaymentCmdCreateSession:
-			if err := c.handleTripAccepted(ctx, payload); err != nil {
-				log.Printf("Failed to handle trip accepted: %v", err)
-				return err
-			}
-		}
-
 		return nil
 	})
+
+	return c.rabbitmq.ConsumeEvents(messaging.PaymentTripResponseQueue, router)
 }
 
 func (c *TripConsumer) handleTripAccepted(ctx context.Context, payload messaging.PaymentTripResponseData) error {
@@ -76,18 +64,7 @@ func (c *TripConsumer) handleTripAccepted(ctx context.Context, payload messaging
 		Currency:  paymentSession.Currency,
 	}
 
-	payloadBytes, err := json.Marshal(paymentPayload)
-	if err != nil {
-		log.Printf("Failed to marshal payment session payload: %v", err)
-		return err
-	}
-
-	if err := c.rabbitmq.PublishMessage(ctx, contracts.PaymentEventSessionCreated,
-		contracts.AmqpMessage{
-			OwnerID: payload.UserID,
-			Data:    payloadBytes,
-		},
-	); err != nil {
+	if err := messaging.Publish(ctx, c.rabbitmq, contracts.PaymentEventSessionCreated, payload.UserID, paymentPayload); err != nil {
 		log.Printf("Failed to publish payment session created event: %v", err)
 		return err
 	}
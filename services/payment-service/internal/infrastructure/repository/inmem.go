@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"ride-sharing/services/payment-service/pkg/types"
+)
+
+type inmemRepository struct {
+	intents map[string]*types.PaymentIntent // intentID -> intent
+	byTrip  map[string]string               // tripID -> latest intentID
+	mu      sync.RWMutex
+}
+
+func NewInmemRepository() *inmemRepository {
+	return &inmemRepository{
+		intents: make(map[string]*types.PaymentIntent),
+		byTrip:  make(map[string]string),
+	}
+}
+
+func (r *inmemRepository) SavePaymentIntent(ctx context.Context, intent *types.PaymentIntent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.intents[intent.ID] = intent
+	r.byTrip[intent.TripID] = intent.ID
+
+	return nil
+}
+
+func (r *inmemRepository) GetPaymentIntentByTripID(ctx context.Context, tripID string) (*types.PaymentIntent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	intentID, ok := r.byTrip[tripID]
+	if !ok {
+		return nil, nil
+	}
+
+	return r.intents[intentID], nil
+}
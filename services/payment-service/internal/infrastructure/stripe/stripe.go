@@ -22,11 +22,11 @@ func NewStripeClient(config *types.PaymentConfig) domain.PaymentProcessor {
 	}
 }
 
-func (s *stripeClient) CreatePaymentSession(ctx context.Context, amount int64, currency string, metadata map[string]string) (string, error) {
+func (s *stripeClient) CreatePaymentSession(ctx context.Context, tripID string, amount int64, currency string, metadata map[string]string) (string, error) {
 	params := &stripe.CheckoutSessionParams{
 		SuccessURL: stripe.String(s.config.SuccessURL),
 		CancelURL:  stripe.String(s.config.CancelURL),
-		Metadata: metadata,
+		Metadata:   metadata,
 		LineItems: []*stripe.CheckoutSessionLineItemParams{
 			{
 				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
@@ -41,6 +41,10 @@ func (s *stripeClient) CreatePaymentSession(ctx context.Context, amount int64, c
 		},
 		Mode: stripe.String(string(stripe.CheckoutSessionModePayment)),
 	}
+	params.Context = ctx
+
+	// Stripe returns the session it created for the key instead of a new one, for 24 hours
+	params.SetIdempotencyKey("checkout-session-" + tripID)
 
 	result, err := session.New(params)
 	if err != nil {
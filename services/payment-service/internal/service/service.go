@@ -13,16 +13,19 @@ import (
 
 type paymentService struct {
 	paymentProcessor domain.PaymentProcessor
+	repo             domain.Repository
 }
 
 // NewPaymentService creates a new instance of the payment service
-func NewPaymentService(paymentProcessor domain.PaymentProcessor) domain.Service {
+func NewPaymentService(paymentProcessor domain.PaymentProcessor, repo domain.Repository) domain.Service {
 	return &paymentService{
 		paymentProcessor: paymentProcessor,
+		repo:             repo,
 	}
 }
 
-// CreatePaymentSession creates a new payment session for a trip
+// CreatePaymentSession creates a new payment session for a trip. A trip has one: the pending session
+// is returned when the trip was accepted again, a redelivery for instance.
 func (s *paymentService) CreatePaymentSession(
 	ctx context.Context,
 	tripID string,
@@ -31,13 +34,22 @@ func (s *paymentService) CreatePaymentSession(
 	amount int64,
 	currency string,
 ) (*types.PaymentIntent, error) {
+	existing, err := s.repo.GetPaymentIntentByTripID(ctx, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment intent: %w", err)
+	}
+
+	if existing != nil && existing.Status == types.PaymentStatusPending {
+		return existing, nil
+	}
+
 	metadata := map[string]string{
 		"trip_id":   tripID,
 		"user_id":   userID,
 		"driver_id": driverID,
 	}
 
-	sessionID, err := s.paymentProcessor.CreatePaymentSession(ctx, amount, currency, metadata)
+	sessionID, err := s.paymentProcessor.CreatePaymentSession(ctx, tripID, amount, currency, metadata)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create payment session: %w", err)
 	}
@@ -49,9 +61,14 @@ func (s *paymentService) CreatePaymentSession(
 		DriverID:        driverID,
 		Amount:          amount,
 		Currency:        currency,
+		Status:          types.PaymentStatusPending,
 		StripeSessionID: sessionID,
 		CreatedAt:       time.Now(),
 	}
 
+	if err := s.repo.SavePaymentIntent(ctx, paymentIntent); err != nil {
+		return nil, fmt.Errorf("failed to save payment intent: %w", err)
+	}
+
 	return paymentIntent, nil
 }
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"context"
+	"ride-sharing/shared/contracts"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxMessage is a message waiting to be published to RabbitMQ. It is saved together with the
+// trip change it describes, and published by the outbox relay afterwards.
+type OutboxMessage struct {
+	ID          primitive.ObjectID    `bson:"_id,omitempty"`
+	RoutingKey  string                `bson:"routingKey"`
+	Message     contracts.AmqpMessage `bson:"message"` // the envelope is built with the change, so retries keep its event ID
+	CreatedAt   time.Time             `bson:"createdAt"`
+	SentAt      *time.Time            `bson:"sentAt,omitempty"`      // the outbox TTL index removes the message some time after
+	LockedUntil *time.Time            `bson:"lockedUntil,omitempty"` // set while a relay is publishing the message
+	Attempts    int                   `bson:"attempts"`
+	LastError   string                `bson:"lastError,omitempty"`
+}
+
+type OutboxRepository interface {
+	SaveOutboxMessage(ctx context.Context, msg *OutboxMessage) error
+	// ClaimOutboxMessages locks up to limit unsent messages, oldest first, so other relays skip them until the lease ends
+	ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error)
+	MarkOutboxMessageSent(ctx context.Context, id primitive.ObjectID, sentAt time.Time) error
+	// ReleaseOutboxMessage unlocks an unsent message so it is retried, recording why publishing failed if it did
+	ReleaseOutboxMessage(ctx context.Context, id primitive.ObjectID, lastError string) error
+}
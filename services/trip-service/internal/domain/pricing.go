@@ -0,0 +1,182 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ride-sharing/shared/types"
+	"strings"
+	"time"
+)
+
+var ErrPickupNotServed = errors.New("no pricing rules cover the pickup location")
+
+// PricingRules is a versioned set of fares, looked up by the city of the pickup and the package
+type PricingRules struct {
+	Version     string         `json:"version" yaml:"version" bson:"version"`
+	PublishedAt time.Time      `json:"publishedAt,omitempty" yaml:"publishedAt,omitempty" bson:"publishedAt"`
+	Cities      []*CityPricing `json:"cities" yaml:"cities" bson:"cities"`
+}
+
+// CityPricing applies to the pickups inside its geofence.
+// A city without a geofence is the fallback for the pickups outside of every other city.
+type CityPricing struct {
+	City          string            `json:"city" yaml:"city" bson:"city"`
+	Geofence      *Geofence         `json:"geofence,omitempty" yaml:"geofence,omitempty" bson:"geofence,omitempty"`
+	Timezone      string            `json:"timezone,omitempty" yaml:"timezone,omitempty" bson:"timezone,omitempty"` // IANA name, UTC if empty
+	Packages      []*PackagePricing `json:"packages" yaml:"packages" bson:"packages"`
+	TimeModifiers []*TimeModifier   `json:"timeModifiers,omitempty" yaml:"timeModifiers,omitempty" bson:"timeModifiers,omitempty"`
+}
+
+// Geofence is a latitude/longitude bounding box
+type Geofence struct {
+	MinLatitude  float64 `json:"minLatitude" yaml:"minLatitude" bson:"minLatitude"`
+	MinLongitude float64 `json:"minLongitude" yaml:"minLongitude" bson:"minLongitude"`
+	MaxLatitude  float64 `json:"maxLatitude" yaml:"maxLatitude" bson:"maxLatitude"`
+	MaxLongitude float64 `json:"maxLongitude" yaml:"maxLongitude" bson:"maxLongitude"`
+}
+
+func (g *Geofence) Contains(c *types.Coordinate) bool {
+	return c.Latitude >= g.MinLatitude && c.Latitude <= g.MaxLatitude &&
+		c.Longitude >= g.MinLongitude && c.Longitude <= g.MaxLongitude
+}
+
+type PackagePricing struct {
+	PackageSlug        string  `json:"packageSlug" yaml:"packageSlug" bson:"packageSlug"`
+	BaseFareInCents    float64 `json:"baseFareInCents" yaml:"baseFareInCents" bson:"baseFareInCents"`
+	MinimumFareInCents float64 `json:"minimumFareInCents" yaml:"minimumFareInCents" bson:"minimumFareInCents"`
+	BookingFeeInCents  float64 `json:"bookingFeeInCents" yaml:"bookingFeeInCents" bson:"bookingFeeInCents"` // never multiplied
+	PerKmInCents       float64 `json:"perKmInCents" yaml:"perKmInCents" bson:"perKmInCents"`
+	PerMinuteInCents   float64 `json:"perMinuteInCents" yaml:"perMinuteInCents" bson:"perMinuteInCents"`
+}
+
+// TimeModifier multiplies the fares of the trips requested between StartHour (inclusive) and EndHour (exclusive),
+// in the city's timezone. A window can wrap around midnight, ex: 22 to 5.
+type TimeModifier struct {
+	Name       string   `json:"name" yaml:"name" bson:"name"`
+	Days       []string `json:"days,omitempty" yaml:"days,omitempty" bson:"days,omitempty"` // ex: ["sat", "sun"], every day if empty
+	StartHour  int      `json:"startHour" yaml:"startHour" bson:"startHour"`
+	EndHour    int      `json:"endHour" yaml:"endHour" bson:"endHour"`
+	Multiplier float64  `json:"multiplier" yaml:"multiplier" bson:"multiplier"`
+}
+
+// Applies reports whether the modifier covers the local time
+func (m *TimeModifier) Applies(at time.Time) bool {
+	if len(m.Days) > 0 {
+		day := strings.ToLower(at.Weekday().String()[:3])
+
+		found := false
+		for _, d := range m.Days {
+			if strings.ToLower(d) == day {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	hour := at.Hour()
+	if m.StartHour <= m.EndHour {
+		return hour >= m.StartHour && hour < m.EndHour
+	}
+	return hour >= m.StartHour || hour < m.EndHour
+}
+
+// CityFor returns the pricing of the city the pickup is in, or nil if no city covers it
+func (r *PricingRules) CityFor(pickup *types.Coordinate) *CityPricing {
+	var fallback *CityPricing
+	for _, city := range r.Cities {
+		if city.Geofence == nil {
+			fallback = city
+			continue
+		}
+
+		if pickup != nil && city.Geofence.Contains(pickup) {
+			return city
+		}
+	}
+	return fallback
+}
+
+// Validate makes sure the rules can be used to price trips before they replace the current ones
+func (r *PricingRules) Validate() error {
+	if r.Version == "" {
+		return errors.New("pricing rules have no version")
+	}
+
+	fallbacks := 0
+	for _, city := range r.Cities {
+		if city.City == "" {
+			return errors.New("pricing rules contain a city without a name")
+		}
+
+		if city.Geofence == nil {
+			fallbacks++
+		}
+
+		if _, err := time.LoadLocation(city.Timezone); err != nil {
+			return fmt.Errorf("city %s: %w", city.City, err)
+		}
+
+		if len(city.Packages) == 0 {
+			return fmt.Errorf("city %s has no packages", city.City)
+		}
+
+		for _, p := range city.Packages {
+			if p.PackageSlug == "" {
+				return fmt.Errorf("city %s contains a package without a slug", city.City)
+			}
+
+			if p.BaseFareInCents < 0 || p.MinimumFareInCents < 0 || p.BookingFeeInCents < 0 ||
+				p.PerKmInCents < 0 || p.PerMinuteInCents < 0 {
+				return fmt.Errorf("city %s, package %s: prices cannot be negative", city.City, p.PackageSlug)
+			}
+		}
+
+		for _, m := range city.TimeModifiers {
+			if m.StartHour < 0 || m.StartHour > 23 || m.EndHour < 0 || m.EndHour > 24 {
+				return fmt.Errorf("city %s, modifier %s: hours must be between 0 and 24", city.City, m.Name)
+			}
+
+			if m.Multiplier <= 0 {
+				return fmt.Errorf("city %s, modifier %s: multiplier must be positive", city.City, m.Name)
+			}
+		}
+	}
+
+	if fallbacks > 1 {
+		return errors.New("pricing rules can have only one city without a geofence")
+	}
+
+	return nil
+}
+
+// PricingRuleSource loads the latest pricing rules, from a file or a database
+type PricingRuleSource interface {
+	Load(ctx context.Context) (*PricingRules, error)
+}
+
+// DefaultPricingRules are used when no rule source is configured. They apply everywhere.
+func DefaultPricingRules() *PricingRules {
+	packages := []*PackagePricing{
+		{PackageSlug: "suv", BaseFareInCents: 200},
+		{PackageSlug: "sedan", BaseFareInCents: 350},
+		{PackageSlug: "van", BaseFareInCents: 400},
+		{PackageSlug: "luxury", BaseFareInCents: 1000},
+	}
+
+	for _, p := range packages {
+		p.PerKmInCents = 1500
+		p.PerMinuteInCents = 15
+	}
+
+	return &PricingRules{
+		Version: "default",
+		Cities: []*CityPricing{
+			{City: "default", Packages: packages},
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func validPricingRules() *PricingRules {
+	return &PricingRules{
+		Version: "v1",
+		Cities: []*CityPricing{
+			{
+				City:     "paris",
+				Geofence: &Geofence{MinLatitude: 48.8, MinLongitude: 2.2, MaxLatitude: 48.9, MaxLongitude: 2.5},
+				Timezone: "Europe/Paris",
+				Packages: []*PackagePricing{
+					{PackageSlug: "sedan", BaseFareInCents: 300, PerKmInCents: 120, PerMinuteInCents: 30},
+				},
+				TimeModifiers: []*TimeModifier{
+					{Name: "night", StartHour: 22, EndHour: 5, Multiplier: 1.5},
+				},
+			},
+			{
+				City:     "default",
+				Packages: []*PackagePricing{{PackageSlug: "sedan", BaseFareInCents: 350}},
+			},
+		},
+	}
+}
+
+func TestPricingRulesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *PricingRules)
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *PricingRules) {},
+		},
+		{
+			name:   "modifier ending at midnight",
+			modify: func(r *PricingRules) { r.Cities[0].TimeModifiers[0].EndHour = 24 },
+		},
+		{
+			name:    "no version",
+			modify:  func(r *PricingRules) { r.Version = "" },
+			wantErr: "no version",
+		},
+		{
+			name:    "city without a name",
+			modify:  func(r *PricingRules) { r.Cities[1].City = "" },
+			wantErr: "without a name",
+		},
+		{
+			name:    "unknown timezone",
+			modify:  func(r *PricingRules) { r.Cities[0].Timezone = "Europe/Atlantis" },
+			wantErr: "city paris",
+		},
+		{
+			name:    "city without packages",
+			modify:  func(r *PricingRules) { r.Cities[0].Packages = nil },
+			wantErr: "has no packages",
+		},
+		{
+			name:    "package without a slug",
+			modify:  func(r *PricingRules) { r.Cities[0].Packages[0].PackageSlug = "" },
+			wantErr: "without a slug",
+		},
+		{
+			name:    "negative price",
+			modify:  func(r *PricingRules) { r.Cities[0].Packages[0].PerKmInCents = -1 },
+			wantErr: "cannot be negative",
+		},
+		{
+			name:    "negative booking fee",
+			modify:  func(r *PricingRules) { r.Cities[1].Packages[0].BookingFeeInCents = -100 },
+			wantErr: "cannot be negative",
+		},
+		{
+			name:    "start hour out of range",
+			modify:  func(r *PricingRules) { r.Cities[0].TimeModifiers[0].StartHour = 24 },
+			wantErr: "between 0 and 24",
+		},
+		{
+			name:    "end hour out of range",
+			modify:  func(r *PricingRules) { r.Cities[0].TimeModifiers[0].EndHour = 25 },
+			wantErr: "between 0 and 24",
+		},
+		{
+			name:    "zero multiplier",
+			modify:  func(r *PricingRules) { r.Cities[0].TimeModifiers[0].Multiplier = 0 },
+			wantErr: "must be positive",
+		},
+		{
+			name:    "two fallback cities",
+			modify:  func(r *PricingRules) { r.Cities[0].Geofence = nil },
+			wantErr: "only one city without a geofence",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := validPricingRules()
+			tt.modify(rules)
+
+			err := rules.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultPricingRulesAreValid(t *testing.T) {
+	if err := DefaultPricingRules().Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+}
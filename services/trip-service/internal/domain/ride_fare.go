@@ -1,18 +1,54 @@
 package domain
 
 import (
+	"errors"
 	"ride-sharing/services/trip-service/pkg/types"
 	pb "ride-sharing/shared/proto/trip"
+	sharedTypes "ride-sharing/shared/types"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// RideFareTTL is how long a rider has to book a previewed fare
+const RideFareTTL = 10 * time.Minute
+
+var (
+	ErrFareNotFound    = errors.New("fare does not exist")
+	ErrFareNotOwned    = errors.New("fare does not belong to the user")
+	ErrFareExpired     = errors.New("fare has expired")
+	ErrFareAlreadyUsed = errors.New("fare was already used for another trip")
+)
+
 type RideFareModel struct {
-	ID                primitive.ObjectID     `bson:"_id,omitempty"`
-	UserID            string                 `bson:"userID"`
-	PackageSlug       string                 `bson:"packageSlug"` // ex: van, luxury, sedan
-	TotalPriceInCents float64                `bson:"totalPriceInCents"`
-	Route             *types.OsrmApiResponse `bson:"route"`
+	ID                primitive.ObjectID      `bson:"_id,omitempty"`
+	UserID            string                  `bson:"userID"`
+	PackageSlug       string                  `bson:"packageSlug"` // ex: van, luxury, sedan
+	TotalPriceInCents float64                 `bson:"totalPriceInCents"`
+	Route             *types.OsrmApiResponse  `bson:"route"`
+	Pickup            *sharedTypes.Coordinate `bson:"pickup"`
+	Destination       *sharedTypes.Coordinate `bson:"destination"`
+	SurgeMultiplier   float64                 `bson:"surgeMultiplier"` // already applied to TotalPriceInCents
+	SurgeArea         string                  `bson:"surgeArea"`       // geohash of the area the surge was computed for
+	PricingVersion    string                  `bson:"pricingVersion"`  // version of the pricing rules that produced the fare
+	PricingCity       string                  `bson:"pricingCity"`
+	CreatedAt         time.Time               `bson:"createdAt"`
+	ExpiresAt         time.Time               `bson:"expiresAt"`            // the ride_fares TTL index removes the fare some time after
+	ConsumedAt        *time.Time              `bson:"consumedAt,omitempty"` // set once the fare was turned into a trip
+	TripID            string                  `bson:"tripID,omitempty"`     // the trip the fare was used for
+}
+
+// CheckUsable returns ErrFareAlreadyUsed or ErrFareExpired if the fare can't be booked anymore
+func (r *RideFareModel) CheckUsable(now time.Time) error {
+	if r.ConsumedAt != nil {
+		return ErrFareAlreadyUsed
+	}
+
+	if !now.Before(r.ExpiresAt) {
+		return ErrFareExpired
+	}
+
+	return nil
 }
 
 func (r *RideFareModel) ToProto() *pb.RideFare {
@@ -21,6 +57,7 @@ func (r *RideFareModel) ToProto() *pb.RideFare {
 		UserID:            r.UserID,
 		PackageSlug:       r.PackageSlug,
 		TotalPriceInCents: r.TotalPriceInCents,
+		SurgeMultiplier:   r.SurgeMultiplier,
 	}
 }
 
@@ -31,3 +68,14 @@ func ToRideFaresProto(fares []*RideFareModel) []*pb.RideFare {
 	}
 	return protoFares
 }
+
+func coordinateToProto(c *sharedTypes.Coordinate) *pb.Coordinate {
+	if c == nil {
+		return nil
+	}
+
+	return &pb.Coordinate{
+		Latitude:  c.Latitude,
+		Longitude: c.Longitude,
+	}
+}
@@ -2,7 +2,9 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"ride-sharing/shared/types"
+	"time"
 
 	tripTypes "ride-sharing/services/trip-service/pkg/types"
 	pbd "ride-sharing/shared/proto/driver"
@@ -11,12 +13,79 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrNotTripParticipant      = errors.New("user is neither the rider nor the driver of this trip")
+	ErrDuplicateIdempotencyKey = errors.New("a trip was already created with this idempotency key")
+	ErrNoDriverOffer           = errors.New("driver does not hold the offer of the trip")
+)
+
+const (
+	CancelledByRider  = "rider"
+	CancelledByDriver = "driver"
+)
+
 type TripModel struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	UserID   string             `bson:"userID"`
-	Status   string             `bson:"status"`
-	RideFare *RideFareModel     `bson:"rideFare"`
-	Driver   *pb.TripDriver     `bson:"driver"`
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	UserID       string             `bson:"userID"`
+	Status       TripStatus         `bson:"status"`
+	RideFare     *RideFareModel     `bson:"rideFare"`
+	Driver       *pb.TripDriver     `bson:"driver"`
+	Cancellation *TripCancellation  `bson:"cancellation,omitempty"`
+	Completion   *TripCompletion    `bson:"completion,omitempty"`
+
+	// IdempotencyKey is sent by the rider's client so a retried request doesn't create a second trip.
+	// It is unique per rider.
+	IdempotencyKey string `bson:"idempotencyKey,omitempty"`
+
+	// Lifecycle timestamps, set when the trip enters the matching status
+	DriverAssignedAt *time.Time `bson:"driverAssignedAt,omitempty"`
+	DriverArrivedAt  *time.Time `bson:"driverArrivedAt,omitempty"`
+	StartedAt        *time.Time `bson:"startedAt,omitempty"`
+	CompletedAt      *time.Time `bson:"completedAt,omitempty"`
+}
+
+// TripCancellation records who cancelled a trip and why
+type TripCancellation struct {
+	CancelledBy string    `bson:"cancelledBy"` // rider or driver
+	UserID      string    `bson:"userID"`
+	Reason      string    `bson:"reason"`
+	CancelledAt time.Time `bson:"cancelledAt"`
+}
+
+// TripFilter narrows down a trip listing. Trips are listed newest first.
+type TripFilter struct {
+	UserID   string
+	DriverID string
+	Statuses []TripStatus
+	Cursor   string // ID of the last trip of the previous page
+	Limit    int
+}
+
+// TripCompletion holds what was actually driven and charged once the trip is over
+type TripCompletion struct {
+	Distance          float64 `bson:"distance"`
+	Duration          float64 `bson:"duration"`
+	TotalPriceInCents float64 `bson:"totalPriceInCents"`
+	PricingVersion    string  `bson:"pricingVersion"` // version of the pricing rules the final price was computed with
+}
+
+// SetStatusTime records when the trip entered the given status
+func (t *TripModel) SetStatusTime(status TripStatus, at time.Time) {
+	switch status {
+	case TripStatusDriverAssigned:
+		t.DriverAssignedAt = &at
+	case TripStatusDriverArrived:
+		t.DriverArrivedAt = &at
+	case TripStatusInProgress:
+		t.StartedAt = &at
+	case TripStatusCompleted:
+		t.CompletedAt = &at
+	}
+}
+
+// HasDriver reports whether a driver has been assigned to the trip
+func (t *TripModel) HasDriver() bool {
+	return t.Driver != nil && t.Driver.Id != ""
 }
 
 func (t *TripModel) ToProto() *pb.Trip {
@@ -24,31 +93,92 @@ func (t *TripModel) ToProto() *pb.Trip {
 		Id:           t.ID.Hex(),
 		UserID:       t.UserID,
 		SelectedFare: t.RideFare.ToProto(),
-		Status:       t.Status,
+		Status:       string(t.Status),
 		Driver:       t.Driver,
 		Route:        t.RideFare.Route.ToProto(),
+		Cancellation: t.Cancellation.ToProto(),
+		Pickup:       coordinateToProto(t.RideFare.Pickup),
+		Destination:  coordinateToProto(t.RideFare.Destination),
+	}
+}
+
+func (c *TripCancellation) ToProto() *pb.TripCancellation {
+	if c == nil {
+		return nil
+	}
+
+	return &pb.TripCancellation{
+		CancelledBy: c.CancelledBy,
+		UserID:      c.UserID,
+		Reason:      c.Reason,
 	}
 }
 
 type TripRepository interface {
+	// CreateTrip returns ErrDuplicateIdempotencyKey if the rider already created a trip with the same key
 	CreateTrip(ctx context.Context, trip *TripModel) (*TripModel, error)
+	// GetTripByIdempotencyKey returns nil if the rider never created a trip with the key
+	GetTripByIdempotencyKey(ctx context.Context, userID, key string) (*TripModel, error)
 	SaveRideFare(ctx context.Context, f *RideFareModel) error
+	// GetRideFareByID returns nil if the fare doesn't exist
 	GetRideFareByID(ctx context.Context, id string) (*RideFareModel, error)
+	// ConsumeRideFare atomically marks the fare as used by the trip, as long as it is unused and not expired.
+	// It returns ErrFareNotFound, ErrFareAlreadyUsed or ErrFareExpired otherwise.
+	ConsumeRideFare(ctx context.Context, fareID, tripID string, now time.Time) error
 	GetTripByID(ctx context.Context, id string) (*TripModel, error)
-	UpdateTrip(ctx context.Context, tripID string, status string, driver *pbd.Driver) error
+	// UpdateTrip moves the trip to the given status, returning a *TripTransitionError if it is not allowed
+	UpdateTrip(ctx context.Context, tripID string, status TripStatus, driver *pbd.Driver) error
+	CancelTrip(ctx context.Context, tripID string, cancellation *TripCancellation) error
+	CompleteTrip(ctx context.Context, tripID string, completion *TripCompletion) error
+	ListTrips(ctx context.Context, filter *TripFilter) ([]*TripModel, error)
+	// WithTransaction runs fn in a transaction: the repository calls made with the ctx it receives,
+	// outbox messages included, are all saved or none are.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type TripService interface {
-	CreateTrip(ctx context.Context, fare *RideFareModel) (*TripModel, error)
+	CreateTrip(ctx context.Context, fare *RideFareModel, idempotencyKey string) (*TripModel, error)
+	// GetTripByIdempotencyKey returns the trip the rider created with the key, or nil
+	GetTripByIdempotencyKey(ctx context.Context, userID, key string) (*TripModel, error)
 	GetRoute(ctx context.Context, pickup, destination *types.Coordinate, useOsrmApi bool) (*tripTypes.OsrmApiResponse, error)
-	EstimatePackagesPriceWithRoute(route *tripTypes.OsrmApiResponse) []*RideFareModel
+	// EstimatePackagesPriceWithRoute prices every package for the route, including the surge at the pickup
+	EstimatePackagesPriceWithRoute(ctx context.Context, route *tripTypes.OsrmApiResponse, pickup *types.Coordinate) ([]*RideFareModel, error)
 	GenerateTripFares(
 		ctx context.Context,
 		fares []*RideFareModel,
 		userID string,
 		Route *tripTypes.OsrmApiResponse,
+		pickup, destination *types.Coordinate,
 	) ([]*RideFareModel, error)
 	GetAndValidateFare(ctx context.Context, fareID, userID string) (*RideFareModel, error)
 	GetTripByID(ctx context.Context, id string) (*TripModel, error)
-	UpdateTrip(ctx context.Context, tripID string, status string, driver *pbd.Driver) error
+	UpdateTrip(ctx context.Context, tripID string, status TripStatus, driver *pbd.Driver) (*TripModel, error)
+	CancelTrip(ctx context.Context, tripID, userID, reason string) (*TripModel, error)
+	// UpdateTripProgress moves the trip forward on behalf of its assigned driver
+	UpdateTripProgress(ctx context.Context, tripID, driverID string, status TripStatus) (*TripModel, error)
+	CompleteTrip(ctx context.Context, tripID, driverID string, distance, duration float64) (*TripModel, error)
+	// ListTrips returns a page of trips and the cursor of the next one, which is empty on the last page
+	ListTrips(ctx context.Context, filter *TripFilter) ([]*TripModel, string, error)
+}
+
+// TripEventPublisher records the messages trip-service sends in the outbox. Called within
+// TripRepository.WithTransaction, the messages are only sent if the trip change is saved.
+type TripEventPublisher interface {
+	// PublishTripStatusChanged sends the trip.event.* message of the status the trip just entered
+	PublishTripStatusChanged(ctx context.Context, trip *TripModel) error
+	// PublishDriverNotInterested tells the rider the driver declined, so the trip is offered to someone else
+	PublishDriverNotInterested(ctx context.Context, trip *TripModel, driverID string) error
+	// PublishPaymentSessionRequested asks the payment service to charge the rider for the completed trip
+	PublishPaymentSessionRequested(ctx context.Context, trip *TripModel) error
+}
+
+// DriverSupply tells how many drivers are available in a geohash area
+type DriverSupply interface {
+	AvailableDrivers(ctx context.Context, geohash string) (int, error)
+}
+
+// DriverOffers tells which driver the trip is currently offered to
+type DriverOffers interface {
+	// OfferedDriver returns the driver if they hold the offer of the trip, or ErrNoDriverOffer
+	OfferedDriver(ctx context.Context, driverID, tripID string) (*pbd.Driver, error)
 }
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TripStatus is the lifecycle state of a trip
+type TripStatus string
+
+const (
+	TripStatusRequested      TripStatus = "requested"
+	TripStatusDriverAssigned TripStatus = "driver_assigned"
+	TripStatusDriverArrived  TripStatus = "driver_arrived"
+	TripStatusInProgress     TripStatus = "in_progress"
+	TripStatusCompleted      TripStatus = "completed"
+	TripStatusPaid           TripStatus = "paid"
+	TripStatusCancelled      TripStatus = "cancelled"
+	TripStatusExpired        TripStatus = "expired"
+)
+
+var ErrInvalidTripTransition = errors.New("invalid trip status transition")
+
+// TripTransitionError is returned when a trip is moved to a status that is not reachable from its current one
+type TripTransitionError struct {
+	TripID string
+	From   TripStatus
+	To     TripStatus
+}
+
+func (e *TripTransitionError) Error() string {
+	return fmt.Sprintf("trip %s cannot move from %q to %q", e.TripID, e.From, e.To)
+}
+
+func (e *TripTransitionError) Unwrap() error {
+	return ErrInvalidTripTransition
+}
+
+// tripTransitions lists, for every status, the statuses a trip is allowed to move to next
+var tripTransitions = map[TripStatus][]TripStatus{
+	TripStatusRequested: {
+		TripStatusDriverAssigned,
+		TripStatusCancelled,
+		TripStatusExpired,
+	},
+	TripStatusDriverAssigned: {
+		TripStatusDriverArrived,
+		TripStatusCancelled,
+	},
+	TripStatusDriverArrived: {
+		TripStatusInProgress,
+		TripStatusCancelled,
+	},
+	TripStatusInProgress: {
+		TripStatusCompleted,
+	},
+	TripStatusCompleted: {
+		TripStatusPaid,
+	},
+}
+
+// CanTransitionTo reports whether a trip in status s may move to next
+func (s TripStatus) CanTransitionTo(next TripStatus) bool {
+	for _, allowed := range tripTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedFrom returns every status from which a trip may move to s
+func (s TripStatus) AllowedFrom() []TripStatus {
+	var from []TripStatus
+	for status, next := range tripTransitions {
+		for _, n := range next {
+			if n == s {
+				from = append(from, status)
+			}
+		}
+	}
+	return from
+}
+
+// IsValid reports whether s is one of the known trip statuses
+func (s TripStatus) IsValid() bool {
+	switch s {
+	case TripStatusRequested, TripStatusDriverAssigned, TripStatusDriverArrived, TripStatusInProgress,
+		TripStatusCompleted, TripStatusPaid, TripStatusCancelled, TripStatusExpired:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transitions are possible from s
+func (s TripStatus) IsTerminal() bool {
+	return len(tripTransitions[s]) == 0
+}
+
+// ValidateTransition returns a *TripTransitionError if the trip cannot move from one status to the other
+func ValidateTransition(tripID string, from, to TripStatus) error {
+	if !from.CanTransitionTo(to) {
+		return &TripTransitionError{TripID: tripID, From: from, To: to}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+var allTripStatuses = []TripStatus{
+	TripStatusRequested,
+	TripStatusDriverAssigned,
+	TripStatusDriverArrived,
+	TripStatusInProgress,
+	TripStatusCompleted,
+	TripStatusPaid,
+	TripStatusCancelled,
+	TripStatusExpired,
+}
+
+func TestTripTransitions(t *testing.T) {
+	tests := []struct {
+		from TripStatus
+		to   []TripStatus
+	}{
+		{TripStatusRequested, []TripStatus{TripStatusDriverAssigned, TripStatusCancelled, TripStatusExpired}},
+		{TripStatusDriverAssigned, []TripStatus{TripStatusDriverArrived, TripStatusCancelled}},
+		{TripStatusDriverArrived, []TripStatus{TripStatusInProgress, TripStatusCancelled}},
+		{TripStatusInProgress, []TripStatus{TripStatusCompleted}},
+		{TripStatusCompleted, []TripStatus{TripStatusPaid}},
+		{TripStatusPaid, nil},
+		{TripStatusCancelled, nil},
+		{TripStatusExpired, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from), func(t *testing.T) {
+			for _, to := range allTripStatuses {
+				want := slices.Contains(tt.to, to)
+				if got := tt.from.CanTransitionTo(to); got != want {
+					t.Errorf("CanTransitionTo(%q) = %v, want %v", to, got, want)
+				}
+			}
+
+			if got, want := tt.from.IsTerminal(), len(tt.to) == 0; got != want {
+				t.Errorf("IsTerminal() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestAllowedFrom(t *testing.T) {
+	tests := []struct {
+		to   TripStatus
+		from []TripStatus
+	}{
+		{TripStatusRequested, nil},
+		{TripStatusDriverAssigned, []TripStatus{TripStatusRequested}},
+		{TripStatusInProgress, []TripStatus{TripStatusDriverArrived}},
+		{TripStatusCancelled, []TripStatus{TripStatusRequested, TripStatusDriverAssigned, TripStatusDriverArrived}},
+		{TripStatusPaid, []TripStatus{TripStatusCompleted}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.to), func(t *testing.T) {
+			got := tt.to.AllowedFrom()
+			slices.Sort(got)
+			want := slices.Clone(tt.from)
+			slices.Sort(want)
+
+			if !slices.Equal(got, want) {
+				t.Errorf("AllowedFrom() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTripStatusIsValid(t *testing.T) {
+	for _, status := range allTripStatuses {
+		if !status.IsValid() {
+			t.Errorf("%q.IsValid() = false, want true", status)
+		}
+	}
+
+	for _, status := range []TripStatus{"", "pending", "REQUESTED"} {
+		if status.IsValid() {
+			t.Errorf("%q.IsValid() = true, want false", status)
+		}
+	}
+}
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    TripStatus
+		to      TripStatus
+		wantErr bool
+	}{
+		{"assign a requested trip", TripStatusRequested, TripStatusDriverAssigned, false},
+		{"expire a requested trip", TripStatusRequested, TripStatusExpired, false},
+		{"cancel before pickup", TripStatusDriverArrived, TripStatusCancelled, false},
+		{"pay a completed trip", TripStatusCompleted, TripStatusPaid, false},
+		{"skip the pickup", TripStatusDriverAssigned, TripStatusInProgress, true},
+		{"cancel a trip in progress", TripStatusInProgress, TripStatusCancelled, true},
+		{"assign twice", TripStatusDriverAssigned, TripStatusDriverAssigned, true},
+		{"expire an assigned trip", TripStatusDriverAssigned, TripStatusExpired, true},
+		{"leave a terminal status", TripStatusCancelled, TripStatusRequested, true},
+		{"unknown status", "unknown", TripStatusRequested, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTransition("trip-1", tt.from, tt.to)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("ValidateTransition() = %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidTripTransition) {
+				t.Fatalf("ValidateTransition() = %v, want ErrInvalidTripTransition", err)
+			}
+
+			var transitionErr *TripTransitionError
+			if !errors.As(err, &transitionErr) {
+				t.Fatalf("ValidateTransition() = %T, want *TripTransitionError", err)
+			}
+			if transitionErr.TripID != "trip-1" || transitionErr.From != tt.from || transitionErr.To != tt.to {
+				t.Errorf("ValidateTransition() = %+v, want trip-1 from %q to %q", transitionErr, tt.from, tt.to)
+			}
+		})
+	}
+}
@@ -2,65 +2,75 @@ package events
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"ride-sharing/services/trip-service/internal/domain"
 	"ride-sharing/shared/contracts"
 	"ride-sharing/shared/messaging"
-	pbd "ride-sharing/shared/proto/driver"
-
-	"github.com/rabbitmq/amqp091-go"
 )
 
 type driverConsumer struct {
-	rabbitmq *messaging.RabbitMQ
-	service  domain.TripService
+	rabbitmq  *messaging.RabbitMQ
+	service   domain.TripService
+	publisher domain.TripEventPublisher
+	drivers   domain.DriverOffers
+	inbox     messaging.InboxStore
 }
 
-func NewDriverConsumer(rabbitmq *messaging.RabbitMQ, service domain.TripService) *driverConsumer {
+func NewDriverConsumer(rabbitmq *messaging.RabbitMQ, service domain.TripService, publisher domain.TripEventPublisher, drivers domain.DriverOffers, inbox messaging.InboxStore) *driverConsumer {
 	return &driverConsumer{
-		rabbitmq: rabbitmq,
-		service:  service,
+		rabbitmq:  rabbitmq,
+		service:   service,
+		publisher: publisher,
+		drivers:   drivers,
+		inbox:     inbox,
 	}
 }
 
 func (c *driverConsumer) Listen() error {
-	return c.rabbitmq.ConsumeMessages(messaging.DriverTripResponseQueue, func(ctx context.Context, msg amqp091.Delivery) error {
-		var message contracts.AmqpMessage
-		if err := json.Unmarshal(msg.Body, &message); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			return err
+	if err := c.listenTripProgress(); err != nil {
+		return err
+	}
+
+	if err := c.listenNoDriversFound(); err != nil {
+		return err
+	}
+
+	router := messaging.NewRouter()
+	router.UseInbox(c.inbox)
+
+	messaging.On(router, contracts.DriverCmdTripAccept, func(ctx context.Context, e *messaging.Event[messaging.DriverTripResponseData]) error {
+		log.Printf("driver response received message: %+v", e.Payload)
+
+		// The gateway sets the owner to the driver who sent the command, the payload comes from its client
+		driverID := e.OwnerID
+		if e.Payload.Driver != nil && e.Payload.Driver.Id != driverID {
+			log.Printf("Ignoring the trip accept of driver %s on behalf of driver %s", driverID, e.Payload.Driver.Id)
+			return nil
 		}
 
-		var payload messaging.DriverTripResponseData
-		if err := json.Unmarshal(message.Data, &payload); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
+		if err := c.handleTripAccepted(ctx, e.Payload.TripID, driverID); err != nil {
+			log.Printf("Failed to handle the trip accept: %v", err)
 			return err
 		}
+		return nil
+	})
 
-		log.Printf("driver response received message: %+v", payload)
+	messaging.On(router, contracts.DriverCmdTripDecline, func(ctx context.Context, e *messaging.Event[messaging.DriverTripResponseData]) error {
+		log.Printf("driver response received message: %+v", e.Payload)
 
-		switch msg.RoutingKey {
-		case contracts.DriverCmdTripAccept:
-			if err := c.handleTripAccepted(ctx, payload.TripID, payload.Driver); err != nil {
-				log.Printf("Failed to handle the trip accept: %v", err)
-				return err
-			}
-		case contracts.DriverCmdTripDecline:
-			if err := c.handleTripDeclined(ctx, payload.TripID, payload.RiderID); err != nil {
-				log.Printf("Failed to handle the trip decline: %v", err)
-				return err
-			}
-			return nil
+		if err := c.handleTripDeclined(ctx, e.Payload.TripID, e.OwnerID); err != nil {
+			log.Printf("Failed to handle the trip decline: %v", err)
+			return err
 		}
-		log.Printf("unknown trip event: %+v", payload)
-
 		return nil
 	})
+
+	return c.rabbitmq.ConsumeEvents(messaging.DriverTripResponseQueue, router)
 }
 
-func (c *driverConsumer) handleTripDeclined(ctx context.Context, tripID, riderID string) error {
+func (c *driverConsumer) handleTripDeclined(ctx context.Context, tripID, driverID string) error {
 	// When a driver declines, we should try to find another driver
 
 	trip, err := c.service.GetTripByID(ctx, tripID)
@@ -68,29 +78,25 @@ func (c *driverConsumer) handleTripDeclined(ctx context.Context, tripID, riderID
 		return err
 	}
 
-	newPayload := messaging.TripEventData{
-		Trip: trip.ToProto(),
+	if trip == nil {
+		return fmt.Errorf("Trip was not found %s", tripID)
 	}
 
-	marshalledPayload, err := json.Marshal(newPayload)
-	if err != nil {
-		return err
-	}
+	return c.publisher.PublishDriverNotInterested(ctx, trip, driverID)
+}
 
-	if err := c.rabbitmq.PublishMessage(ctx, contracts.TripEventDriverNotInterested,
-		contracts.AmqpMessage{
-			OwnerID: riderID,
-			Data:    marshalledPayload,
-		},
-	); err != nil {
+func (c *driverConsumer) handleTripAccepted(ctx context.Context, tripID, driverID string) error {
+	// 1. Only the driver holding the offer can take the trip, their record comes from the driver service
+	driver, err := c.drivers.OfferedDriver(ctx, driverID, tripID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoDriverOffer) {
+			log.Printf("Ignoring the trip accept: %v", err)
+			return nil
+		}
 		return err
 	}
 
-	return nil
-}
-
-func (c *driverConsumer) handleTripAccepted(ctx context.Context, tripID string, driver *pbd.Driver) error {
-	// 1. Fetch the first
+	// 2. Fetch the trip
 	trip, err := c.service.GetTripByID(ctx, tripID)
 	if err != nil {
 		return err
@@ -100,47 +106,92 @@ func (c *driverConsumer) handleTripAccepted(ctx context.Context, tripID string,
 		return fmt.Errorf("Trip was not found %s", tripID)
 	}
 
-	// 2. Update the trip
-	if err := c.service.UpdateTrip(ctx, tripID, "accepted", driver); err != nil {
+	// 3. Update the trip, the rider is notified through the trip.event.driver_assigned event
+	trip, err = c.service.UpdateTrip(ctx, tripID, domain.TripStatusDriverAssigned, driver)
+	if err != nil {
+		// A trip that already moved on (e.g. accepted by another driver) must not be retried
+		if errors.Is(err, domain.ErrInvalidTripTransition) {
+			log.Printf("Ignoring the trip accept: %v", err)
+			return nil
+		}
+
 		log.Printf("Failed to update the trip: %v", err)
 		return err
 	}
 
-	trip, err = c.service.GetTripByID(ctx, tripID)
-	if err != nil {
-		return err
-	}
+	log.Printf("Driver %s assigned to trip %s", driver.Id, trip.ID.Hex())
 
-	// 3. Driver has been assigned -> publish this event to RB
-	marshalledTrip, err := json.Marshal(trip)
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	// Notify the rider that a driver has been assigned
-	if err := c.rabbitmq.PublishMessage(ctx, contracts.TripEventDriverAssigned, contracts.AmqpMessage{
-		OwnerID: trip.UserID,
-		Data:    marshalledTrip,
-	}); err != nil {
-		return err
-	}
+// listenNoDriversFound expires the trips the dispatch gave up on
+func (c *driverConsumer) listenNoDriversFound() error {
+	router := messaging.NewRouter()
+	router.UseInbox(c.inbox)
+
+	messaging.On(router, contracts.TripEventNoDriversFound, func(ctx context.Context, e *messaging.Event[messaging.TripEventData]) error {
+		if e.Payload.Trip == nil {
+			return fmt.Errorf("no trip in the %s event", e.EventType)
+		}
+
+		tripID := e.Payload.Trip.Id
+		if _, err := c.service.UpdateTrip(ctx, tripID, domain.TripStatusExpired, nil); err != nil {
+			// The trip was cancelled by the rider in the meantime
+			if errors.Is(err, domain.ErrInvalidTripTransition) {
+				log.Printf("Ignoring the end of the dispatch: %v", err)
+				return nil
+			}
+
+			return err
+		}
 
-	marshalledPayload, err := json.Marshal(messaging.PaymentTripResponseData{
-		TripID:   tripID,
-		UserID:   trip.UserID,
-		DriverID: driver.Id,
-		Amount:   trip.RideFare.TotalPriceInCents,
-		Currency: "USD",
+		log.Printf("Trip %s expired, no driver took it", tripID)
+
+		return nil
 	})
 
-	if err := c.rabbitmq.PublishMessage(ctx, contracts.PaymentCmdCreateSession,
-		contracts.AmqpMessage{
-			OwnerID: trip.UserID,
-			Data:    marshalledPayload,
-		},
-	); err != nil {
+	return c.rabbitmq.ConsumeEvents(messaging.TripNoDriversFoundQueue, router)
+}
+
+// tripProgressStatuses maps the driver progress commands to the trip status they move to
+var tripProgressStatuses = map[string]domain.TripStatus{
+	contracts.DriverCmdArrived:   domain.TripStatusDriverArrived,
+	contracts.DriverCmdTripStart: domain.TripStatusInProgress,
+}
+
+func (c *driverConsumer) listenTripProgress() error {
+	router := messaging.NewRouter()
+	router.UseInbox(c.inbox)
+
+	handleProgress := func(ctx context.Context, e *messaging.Event[messaging.DriverTripProgressData]) error {
+		// The gateway sets the owner to the driver who sent the command
+		driverID := e.OwnerID
+
+		var err error
+		if e.EventType == contracts.DriverCmdTripComplete {
+			err = c.handleTripCompleted(ctx, e.Payload, driverID)
+		} else {
+			_, err = c.service.UpdateTripProgress(ctx, e.Payload.TripID, driverID, tripProgressStatuses[e.EventType])
+		}
+
+		// Commands for someone else's trip or out of order are not worth retrying
+		if errors.Is(err, domain.ErrInvalidTripTransition) || errors.Is(err, domain.ErrNotTripParticipant) {
+			log.Printf("Ignoring the %s command: %v", e.EventType, err)
+			return nil
+		}
+
 		return err
 	}
 
-	return nil
+	messaging.On(router, contracts.DriverCmdArrived, handleProgress)
+	messaging.On(router, contracts.DriverCmdTripStart, handleProgress)
+	messaging.On(router, contracts.DriverCmdTripComplete, handleProgress)
+
+	return c.rabbitmq.ConsumeEvents(messaging.DriverTripProgressQueue, router)
+}
+
+func (c *driverConsumer) handleTripCompleted(ctx context.Context, payload messaging.DriverTripProgressData, driverID string) error {
+	// The payment session is requested along with the completion, once the final price is known
+	_, err := c.service.CompleteTrip(ctx, payload.TripID, driverID, payload.Distance, payload.Duration)
+	return err
 }
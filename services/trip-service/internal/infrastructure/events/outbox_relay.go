@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"log"
+	"ride-sharing/services/trip-service/internal/domain"
+	"ride-sharing/shared/messaging"
+	"time"
+)
+
+// OutboxRelayConfig controls how the relay drains the outbox
+type OutboxRelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration // how long a claimed message is hidden from the other relays
+}
+
+func DefaultOutboxRelayConfig() *OutboxRelayConfig {
+	return &OutboxRelayConfig{
+		PollInterval: 500 * time.Millisecond,
+		BatchSize:    100,
+		Lease:        30 * time.Second,
+	}
+}
+
+// OutboxRelay publishes the outbox messages to RabbitMQ and marks them as sent. A message is marked
+// only after RabbitMQ took it, so a crash in between publishes it again: delivery is at least once.
+type OutboxRelay struct {
+	outbox   domain.OutboxRepository
+	rabbitmq *messaging.RabbitMQ
+	cfg      *OutboxRelayConfig
+}
+
+func NewOutboxRelay(outbox domain.OutboxRepository, rabbitmq *messaging.RabbitMQ, cfg *OutboxRelayConfig) *OutboxRelay {
+	return &OutboxRelay{
+		outbox:   outbox,
+		rabbitmq: rabbitmq,
+		cfg:      cfg,
+	}
+}
+
+// Run drains the outbox every poll interval until the context is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.drain(ctx); err != nil {
+				log.Printf("Failed to relay the outbox messages: %v", err)
+			}
+		}
+	}
+}
+
+// drain publishes batches until the outbox is empty or a publish fails
+func (r *OutboxRelay) drain(ctx context.Context) error {
+	for {
+		messages, err := r.outbox.ClaimOutboxMessages(ctx, r.cfg.BatchSize, r.cfg.Lease)
+		if err != nil {
+			return err
+		}
+
+		if len(messages) == 0 {
+			return nil
+		}
+
+		if err := r.publishBatch(ctx, messages); err != nil {
+			return err
+		}
+
+		if len(messages) < r.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (r *OutboxRelay) publishBatch(ctx context.Context, messages []*domain.OutboxMessage) error {
+	for i, msg := range messages {
+		err := r.rabbitmq.PublishMessage(ctx, msg.RoutingKey, msg.Message)
+		if err != nil {
+			// Give back the rest of the batch so the messages keep their order on the next attempt
+			if releaseErr := r.outbox.ReleaseOutboxMessage(ctx, msg.ID, err.Error()); releaseErr != nil {
+				log.Printf("Failed to release outbox message %s: %v", msg.ID.Hex(), releaseErr)
+			}
+			for _, rest := range messages[i+1:] {
+				if releaseErr := r.outbox.ReleaseOutboxMessage(ctx, rest.ID, ""); releaseErr != nil {
+					log.Printf("Failed to release outbox message %s: %v", rest.ID.Hex(), releaseErr)
+				}
+			}
+
+			return err
+		}
+
+		// If this fails the message is published again once its lease ends
+		if err := r.outbox.MarkOutboxMessageSent(ctx, msg.ID, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
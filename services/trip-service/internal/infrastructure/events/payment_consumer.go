@@ -2,48 +2,47 @@ package events
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
 
 	"ride-sharing/services/trip-service/internal/domain"
 	"ride-sharing/shared/contracts"
 	"ride-sharing/shared/messaging"
-
-	"github.com/rabbitmq/amqp091-go"
 )
 
 type paymentConsumer struct {
 	rabbitmq *messaging.RabbitMQ
 	service  domain.TripService
+	inbox    messaging.InboxStore
 }
 
-func NewPaymentConsumer(rabbitmq *messaging.RabbitMQ, service domain.TripService) *paymentConsumer {
+func NewPaymentConsumer(rabbitmq *messaging.RabbitMQ, service domain.TripService, inbox messaging.InboxStore) *paymentConsumer {
 	return &paymentConsumer{
 		rabbitmq: rabbitmq,
 		service:  service,
+		inbox:    inbox,
 	}
 }
 
 func (c *paymentConsumer) Listen() error {
-	return c.rabbitmq.ConsumeMessages(messaging.NotifyPaymentSuccessQueue, func(ctx context.Context, msg amqp091.Delivery) error {
-		var message contracts.AmqpMessage
-		if err := json.Unmarshal(msg.Body, &message); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			return err
-		}
-		var payload messaging.PaymentStatusUpdateData
-		if err := json.Unmarshal(message.Data, &payload); err != nil {
-			log.Printf("Failed to unmarshal payload: %v", err)
+	router := messaging.NewRouter()
+	router.UseInbox(c.inbox)
+
+	messaging.On(router, contracts.PaymentEventSuccess, func(ctx context.Context, e *messaging.Event[messaging.PaymentStatusUpdateData]) error {
+		log.Printf("Trip has been completed and paid.")
+
+		if _, err := c.service.UpdateTrip(ctx, e.Payload.TripID, domain.TripStatusPaid, nil); err != nil {
+			// A duplicate or late payment event must not be retried
+			if errors.Is(err, domain.ErrInvalidTripTransition) {
+				log.Printf("Ignoring the payment update: %v", err)
+				return nil
+			}
+
 			return err
 		}
 
-		log.Printf("Trip has been completed and payed.")
-
-		return c.service.UpdateTrip(
-			ctx,
-			payload.TripID,
-			"payed",
-			nil,
-		)
+		return nil
 	})
+
+	return c.rabbitmq.ConsumeEvents(messaging.NotifyPaymentSuccessQueue, router)
 }
@@ -2,34 +2,89 @@ package events
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"ride-sharing/services/trip-service/internal/domain"
 	"ride-sharing/shared/contracts"
 	"ride-sharing/shared/messaging"
+	"time"
 )
 
+// tripStatusEvents maps every trip status to the event published when a trip enters it
+var tripStatusEvents = map[domain.TripStatus]string{
+	domain.TripStatusRequested:      contracts.TripEventCreated,
+	domain.TripStatusDriverAssigned: contracts.TripEventDriverAssigned,
+	domain.TripStatusDriverArrived:  contracts.TripEventDriverArrived,
+	domain.TripStatusInProgress:     contracts.TripEventStarted,
+	domain.TripStatusCompleted:      contracts.TripEventCompleted,
+	domain.TripStatusPaid:           contracts.TripEventPaid,
+	domain.TripStatusCancelled:      contracts.TripEventCancelled,
+	domain.TripStatusExpired:        contracts.TripEventExpired,
+}
+
+// TripEventPublisher writes the trip-service messages to the outbox, the OutboxRelay publishes them
 type TripEventPublisher struct {
-	rabbitmq *messaging.RabbitMQ
+	outbox domain.OutboxRepository
 }
 
-func NewTripEventPublisher(rabbitmq *messaging.RabbitMQ) *TripEventPublisher {
+func NewTripEventPublisher(outbox domain.OutboxRepository) *TripEventPublisher {
 	return &TripEventPublisher{
-		rabbitmq: rabbitmq,
+		outbox: outbox,
 	}
 }
 
-func (p *TripEventPublisher) PublishTripCreated(ctx context.Context, trip *domain.TripModel) error {
-	payload := messaging.TripEventData{
+func (p *TripEventPublisher) PublishTripStatusChanged(ctx context.Context, trip *domain.TripModel) error {
+	routingKey, ok := tripStatusEvents[trip.Status]
+	if !ok {
+		return fmt.Errorf("no event registered for trip status: %s", trip.Status)
+	}
+
+	return enqueue(ctx, p.outbox, routingKey, eventOwnerID(trip), messaging.TripEventData{
 		Trip: trip.ToProto(),
+	})
+}
+
+func (p *TripEventPublisher) PublishDriverNotInterested(ctx context.Context, trip *domain.TripModel, driverID string) error {
+	return enqueue(ctx, p.outbox, contracts.TripEventDriverNotInterested, trip.UserID, messaging.TripEventData{
+		Trip:     trip.ToProto(),
+		DriverID: driverID,
+	})
+}
+
+func (p *TripEventPublisher) PublishPaymentSessionRequested(ctx context.Context, trip *domain.TripModel) error {
+	if trip.Completion == nil {
+		return fmt.Errorf("trip %s has no completion to charge", trip.ID.Hex())
 	}
 
-	tripEventJSON, err := json.Marshal(payload)
+	return enqueue(ctx, p.outbox, contracts.PaymentCmdCreateSession, trip.UserID, messaging.PaymentTripResponseData{
+		TripID:   trip.ID.Hex(),
+		UserID:   trip.UserID,
+		DriverID: trip.Driver.GetId(),
+		Amount:   trip.Completion.TotalPriceInCents,
+		Currency: "USD",
+	})
+}
+
+// enqueue saves the message in the outbox, with the schema version registered for the payload type
+func enqueue[T any](ctx context.Context, outbox domain.OutboxRepository, routingKey, ownerID string, payload T) error {
+	msg, err := messaging.NewEnvelope(ctx, routingKey, ownerID, payload)
 	if err != nil {
 		return err
 	}
 
-	return p.rabbitmq.PublishMessage(ctx, contracts.TripEventCreated, contracts.AmqpMessage{
-		OwnerID: trip.UserID,
-		Data:    tripEventJSON,
+	return outbox.SaveOutboxMessage(ctx, &domain.OutboxMessage{
+		RoutingKey: routingKey,
+		Message:    msg,
+		CreatedAt:  time.Now(),
 	})
 }
+
+// eventOwnerID returns the user that should be notified about the trip event.
+// A rider cancellation is sent to the assigned driver, since the rider already knows about it.
+func eventOwnerID(trip *domain.TripModel) string {
+	if trip.Status == domain.TripStatusCancelled && trip.Cancellation != nil &&
+		trip.Cancellation.CancelledBy == domain.CancelledByRider && trip.HasDriver() {
+		return trip.Driver.Id
+	}
+
+	return trip.UserID
+}
@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"ride-sharing/services/trip-service/internal/domain"
+	pb "ride-sharing/shared/proto/driver"
+	"ride-sharing/shared/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// DriverClient asks the driver service how many drivers are online in an area, and which driver
+// a trip is offered to
+type DriverClient struct {
+	client pb.DriverServiceClient
+	conn   *grpc.ClientConn
+}
+
+func NewDriverClient(driverServiceURL string) (*DriverClient, error) {
+	dialOptions := append(
+		tracing.DialOptionsWithTracing(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+
+	conn, err := grpc.NewClient(driverServiceURL, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DriverClient{
+		client: pb.NewDriverServiceClient(conn),
+		conn:   conn,
+	}, nil
+}
+
+func (c *DriverClient) AvailableDrivers(ctx context.Context, geohash string) (int, error) {
+	res, err := c.client.GetDriverSupply(ctx, &pb.GetDriverSupplyRequest{
+		Geohash: geohash,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(res.GetAvailableDrivers()), nil
+}
+
+func (c *DriverClient) OfferedDriver(ctx context.Context, driverID, tripID string) (*pb.Driver, error) {
+	res, err := c.client.GetDriverOffer(ctx, &pb.GetDriverOfferRequest{
+		DriverID: driverID,
+		TripID:   tripID,
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound, codes.FailedPrecondition:
+			return nil, fmt.Errorf("%w: %v", domain.ErrNoDriverOffer, err)
+		}
+		return nil, err
+	}
+
+	return res.GetDriver(), nil
+}
+
+func (c *DriverClient) Close() error {
+	return c.conn.Close()
+}
@@ -2,12 +2,16 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"ride-sharing/services/trip-service/internal/domain"
-	"ride-sharing/services/trip-service/internal/infrastructure/events"
+	"ride-sharing/shared/auth"
 	pb "ride-sharing/shared/proto/trip"
 	"ride-sharing/shared/types"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -16,14 +20,12 @@ import (
 type gRPCHandler struct {
 	pb.UnimplementedTripServiceServer
 
-	service   domain.TripService
-	publisher *events.TripEventPublisher
+	service domain.TripService
 }
 
-func NewGRPCHandler(server *grpc.Server, service domain.TripService, publisher *events.TripEventPublisher) *gRPCHandler {
+func NewGRPCHandler(server *grpc.Server, service domain.TripService) *gRPCHandler {
 	handler := &gRPCHandler{
-		service:   service,
-		publisher: publisher,
+		service: service,
 	}
 
 	pb.RegisterTripServiceServer(server, handler)
@@ -33,19 +35,49 @@ func NewGRPCHandler(server *grpc.Server, service domain.TripService, publisher *
 func (h *gRPCHandler) CreateTrip(ctx context.Context, req *pb.CreateTripRequest) (*pb.CreateTripResponse, error) {
 	fareID := req.GetRideFareID()
 	userID := req.GetUserID()
+	idempotencyKey := req.GetIdempotencyKey()
+
+	if !primitive.IsValidObjectID(fareID) {
+		return nil, status.Error(codes.InvalidArgument, "invalid ride fare ID")
+	}
+
+	// Riders book for themselves, the fare must be theirs too
+	if err := auth.RequireOwner(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// A retried request returns the trip created the first time, without publishing it again
+	if idempotencyKey != "" {
+		existing, err := h.service.GetTripByIdempotencyKey(ctx, userID, idempotencyKey)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to look up the idempotency key: %v", err)
+		}
+
+		if existing != nil {
+			return &pb.CreateTripResponse{
+				TripID: existing.ID.Hex(),
+			}, nil
+		}
+	}
 
 	rideFare, err := h.service.GetAndValidateFare(ctx, fareID, userID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to validate the fare: %v", err)
+		return nil, fareError("failed to validate the fare", err)
 	}
 
-	trip, err := h.service.CreateTrip(ctx, rideFare)
+	trip, err := h.service.CreateTrip(ctx, rideFare, idempotencyKey)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create the trip: %v", err)
-	}
+		// A concurrent retry won the race: it used the fare or the key first
+		if idempotencyKey != "" && (errors.Is(err, domain.ErrDuplicateIdempotencyKey) || errors.Is(err, domain.ErrFareAlreadyUsed)) {
+			existing, lookupErr := h.service.GetTripByIdempotencyKey(ctx, userID, idempotencyKey)
+			if lookupErr == nil && existing != nil {
+				return &pb.CreateTripResponse{
+					TripID: existing.ID.Hex(),
+				}, nil
+			}
+		}
 
-	if err := h.publisher.PublishTripCreated(ctx, trip); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to publish the trip created event: %v", err)
+		return nil, fareError("failed to create the trip", err)
 	}
 
 	return &pb.CreateTripResponse{
@@ -53,6 +85,116 @@ func (h *gRPCHandler) CreateTrip(ctx context.Context, req *pb.CreateTripRequest)
 	}, nil
 }
 
+func (h *gRPCHandler) CancelTrip(ctx context.Context, req *pb.CancelTripRequest) (*pb.CancelTripResponse, error) {
+	if req.GetTripID() == "" || req.GetUserID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "trip ID and user ID are required")
+	}
+
+	// The user cancels as itself, then it must be the rider or the driver of the trip
+	if err := auth.RequireOwner(ctx, req.GetUserID()); err != nil {
+		return nil, err
+	}
+
+	trip, err := h.service.CancelTrip(ctx, req.GetTripID(), req.GetUserID(), req.GetReason())
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNotTripParticipant):
+			return nil, status.Errorf(codes.PermissionDenied, "failed to cancel the trip: %v", err)
+		case errors.Is(err, domain.ErrInvalidTripTransition):
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to cancel the trip: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to cancel the trip: %v", err)
+	}
+
+	return &pb.CancelTripResponse{
+		Trip: trip.ToProto(),
+	}, nil
+}
+
+func (h *gRPCHandler) GetTrip(ctx context.Context, req *pb.GetTripRequest) (*pb.GetTripResponse, error) {
+	if !primitive.IsValidObjectID(req.GetTripID()) {
+		return nil, status.Error(codes.InvalidArgument, "invalid trip ID")
+	}
+
+	trip, err := h.service.GetTripByID(ctx, req.GetTripID())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get the trip: %v", err)
+	}
+
+	if trip == nil {
+		return nil, status.Errorf(codes.NotFound, "trip not found: %s", req.GetTripID())
+	}
+
+	// Only the rider and the assigned driver see the trip
+	var driverID string
+	if trip.HasDriver() {
+		driverID = trip.Driver.Id
+	}
+	if err := auth.RequireOwner(ctx, trip.UserID, driverID); err != nil {
+		return nil, err
+	}
+
+	return &pb.GetTripResponse{
+		Trip: trip.ToProto(),
+	}, nil
+}
+
+func (h *gRPCHandler) ListTripsByUser(ctx context.Context, req *pb.ListTripsByUserRequest) (*pb.ListTripsResponse, error) {
+	if req.GetUserID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID is required")
+	}
+
+	if err := auth.RequireOwner(ctx, req.GetUserID()); err != nil {
+		return nil, err
+	}
+
+	return h.listTrips(ctx, &domain.TripFilter{UserID: req.GetUserID()}, req.GetStatuses(), req.GetPageSize(), req.GetCursor())
+}
+
+func (h *gRPCHandler) ListTripsByDriver(ctx context.Context, req *pb.ListTripsByDriverRequest) (*pb.ListTripsResponse, error) {
+	if req.GetDriverID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver ID is required")
+	}
+
+	if err := auth.RequireOwner(ctx, req.GetDriverID()); err != nil {
+		return nil, err
+	}
+
+	return h.listTrips(ctx, &domain.TripFilter{DriverID: req.GetDriverID()}, req.GetStatuses(), req.GetPageSize(), req.GetCursor())
+}
+
+func (h *gRPCHandler) listTrips(ctx context.Context, filter *domain.TripFilter, statuses []string, pageSize int32, cursor string) (*pb.ListTripsResponse, error) {
+	for _, s := range statuses {
+		tripStatus := domain.TripStatus(s)
+		if !tripStatus.IsValid() {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown trip status: %s", s)
+		}
+		filter.Statuses = append(filter.Statuses, tripStatus)
+	}
+
+	if cursor != "" && !primitive.IsValidObjectID(cursor) {
+		return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+	}
+
+	filter.Cursor = cursor
+	filter.Limit = int(pageSize)
+
+	trips, nextCursor, err := h.service.ListTrips(ctx, filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list the trips: %v", err)
+	}
+
+	protoTrips := make([]*pb.Trip, len(trips))
+	for i, t := range trips {
+		protoTrips[i] = t.ToProto()
+	}
+
+	return &pb.ListTripsResponse{
+		Trips:      protoTrips,
+		NextCursor: nextCursor,
+	}, nil
+}
+
 func (h *gRPCHandler) PreviewTrip(ctx context.Context, req *pb.PreviewTripRequest) (*pb.PreviewTripResponse, error) {
 	pickup := req.GetStartLocation()
 	destination := req.GetEndLocation()
@@ -68,6 +210,11 @@ func (h *gRPCHandler) PreviewTrip(ctx context.Context, req *pb.PreviewTripReques
 
 	userID := req.GetUserID()
 
+	// The fares are generated for the rider asking
+	if err := auth.RequireOwner(ctx, userID); err != nil {
+		return nil, err
+	}
+
 	// CHANGE THE LAST ARG TO "FALSE" if the OSRM API is not working right now
 	route, err := h.service.GetRoute(ctx, pickupCoord, destinationCoord, true)
 	if err != nil {
@@ -75,9 +222,15 @@ func (h *gRPCHandler) PreviewTrip(ctx context.Context, req *pb.PreviewTripReques
 		return nil, status.Errorf(codes.Internal, "failed to get route: %v", err)
 	}
 
-	estimatedFares := h.service.EstimatePackagesPriceWithRoute(route)
+	estimatedFares, err := h.service.EstimatePackagesPriceWithRoute(ctx, route, pickupCoord)
+	if err != nil {
+		if errors.Is(err, domain.ErrPickupNotServed) {
+			return nil, status.Errorf(codes.FailedPrecondition, "failed to estimate the fares: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to estimate the fares: %v", err)
+	}
 
-	fares, err := h.service.GenerateTripFares(ctx, estimatedFares, userID, route)
+	fares, err := h.service.GenerateTripFares(ctx, estimatedFares, userID, route, pickupCoord, destinationCoord)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to generate the ride fares: %v", err)
 	}
@@ -87,3 +240,30 @@ func (h *gRPCHandler) PreviewTrip(ctx context.Context, req *pb.PreviewTripReques
 		RideFares: domain.ToRideFaresProto(fares),
 	}, nil
 }
+
+// fareError maps the fare errors to a gRPC status. Expired and used fares carry their reason
+// (FARE_EXPIRED, FARE_ALREADY_USED) so the clients can tell the rider to preview the trip again.
+func fareError(msg string, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrFareNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, domain.ErrFareNotOwned):
+		return status.Errorf(codes.PermissionDenied, "%s: %v", msg, err)
+	case errors.Is(err, domain.ErrFareExpired):
+		return withReason(status.New(codes.FailedPrecondition, fmt.Sprintf("%s: %v", msg, err)), "FARE_EXPIRED")
+	case errors.Is(err, domain.ErrFareAlreadyUsed):
+		return withReason(status.New(codes.FailedPrecondition, fmt.Sprintf("%s: %v", msg, err)), "FARE_ALREADY_USED")
+	}
+	return status.Errorf(codes.Internal, "%s: %v", msg, err)
+}
+
+func withReason(st *status.Status, reason string) error {
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: "trip-service",
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,45 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"ride-sharing/services/trip-service/internal/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileRuleSource reads the pricing rules from a JSON or YAML file, ex: a mounted ConfigMap
+type fileRuleSource struct {
+	path string
+}
+
+func NewFileRuleSource(path string) *fileRuleSource {
+	return &fileRuleSource{path: path}
+}
+
+func (s *fileRuleSource) Load(ctx context.Context) (*domain.PricingRules, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules domain.PricingRules
+
+	switch filepath.Ext(s.path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &rules)
+	case ".json":
+		err = json.Unmarshal(data, &rules)
+	default:
+		return nil, fmt.Errorf("unsupported pricing rules file: %s", s.path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+
+	return &rules, nil
+}
@@ -0,0 +1,43 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"ride-sharing/services/trip-service/internal/domain"
+	"ride-sharing/shared/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoRuleSource uses the most recently published pricing rules of the collection.
+// Older versions are kept so the fares they produced can be audited.
+type mongoRuleSource struct {
+	db *mongo.Database
+}
+
+func NewMongoRuleSource(db *mongo.Database) *mongoRuleSource {
+	return &mongoRuleSource{db: db}
+}
+
+func (s *mongoRuleSource) Load(ctx context.Context) (*domain.PricingRules, error) {
+	result := s.db.Collection(db.PricingRulesCollection).FindOne(
+		ctx,
+		bson.M{},
+		options.FindOne().SetSort(bson.D{{Key: "publishedAt", Value: -1}}),
+	)
+	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, errors.New("no pricing rules were published")
+		}
+		return nil, result.Err()
+	}
+
+	var rules domain.PricingRules
+	if err := result.Decode(&rules); err != nil {
+		return nil, err
+	}
+
+	return &rules, nil
+}
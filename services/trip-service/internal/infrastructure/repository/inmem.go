@@ -6,11 +6,19 @@ import (
 	"ride-sharing/services/trip-service/internal/domain"
 	pbd "ride-sharing/shared/proto/driver"
 	pb "ride-sharing/shared/proto/trip"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type inmemRepository struct {
 	trips     map[string]*domain.TripModel
 	rideFares map[string]*domain.RideFareModel
+	outbox    []*domain.OutboxMessage
+	mu        sync.RWMutex
 }
 
 func NewInmemRepository() *inmemRepository {
@@ -21,6 +29,9 @@ func NewInmemRepository() *inmemRepository {
 }
 
 func (r *inmemRepository) GetTripByID(ctx context.Context, id string) (*domain.TripModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	trip, ok := r.trips[id]
 	if !ok {
 		return nil, nil
@@ -28,13 +39,21 @@ func (r *inmemRepository) GetTripByID(ctx context.Context, id string) (*domain.T
 	return trip, nil
 }
 
-func (r *inmemRepository) UpdateTrip(ctx context.Context, tripID string, status string, driver *pbd.Driver) error {
+func (r *inmemRepository) UpdateTrip(ctx context.Context, tripID string, status domain.TripStatus, driver *pbd.Driver) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	trip, ok := r.trips[tripID]
 	if !ok {
 		return fmt.Errorf("trip not found with ID: %s", tripID)
 	}
 
+	if err := domain.ValidateTransition(tripID, trip.Status, status); err != nil {
+		return err
+	}
+
 	trip.Status = status
+	trip.SetStatusTime(status, time.Now())
 
 	if driver != nil {
 		trip.Driver = &pb.TripDriver{
@@ -47,21 +66,207 @@ func (r *inmemRepository) UpdateTrip(ctx context.Context, tripID string, status
 	return nil
 }
 
+func (r *inmemRepository) CancelTrip(ctx context.Context, tripID string, cancellation *domain.TripCancellation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	trip, ok := r.trips[tripID]
+	if !ok {
+		return fmt.Errorf("trip not found with ID: %s", tripID)
+	}
+
+	if err := domain.ValidateTransition(tripID, trip.Status, domain.TripStatusCancelled); err != nil {
+		return err
+	}
+
+	trip.Status = domain.TripStatusCancelled
+	trip.Cancellation = cancellation
+
+	return nil
+}
+
+func (r *inmemRepository) CompleteTrip(ctx context.Context, tripID string, completion *domain.TripCompletion) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	trip, ok := r.trips[tripID]
+	if !ok {
+		return fmt.Errorf("trip not found with ID: %s", tripID)
+	}
+
+	if err := domain.ValidateTransition(tripID, trip.Status, domain.TripStatusCompleted); err != nil {
+		return err
+	}
+
+	trip.Status = domain.TripStatusCompleted
+	trip.SetStatusTime(domain.TripStatusCompleted, time.Now())
+	trip.Completion = completion
+
+	return nil
+}
+
+func (r *inmemRepository) ListTrips(ctx context.Context, filter *domain.TripFilter) ([]*domain.TripModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var trips []*domain.TripModel
+	for id, trip := range r.trips {
+		if filter.UserID != "" && trip.UserID != filter.UserID {
+			continue
+		}
+		if filter.DriverID != "" && (!trip.HasDriver() || trip.Driver.Id != filter.DriverID) {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, trip.Status) {
+			continue
+		}
+		// Object IDs are fixed-length hex, so they sort by creation time as strings
+		if filter.Cursor != "" && id >= filter.Cursor {
+			continue
+		}
+
+		trips = append(trips, trip)
+	}
+
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].ID.Hex() > trips[j].ID.Hex()
+	})
+
+	if filter.Limit > 0 && len(trips) > filter.Limit {
+		trips = trips[:filter.Limit]
+	}
+
+	return trips, nil
+}
+
 func (r *inmemRepository) GetRideFareByID(ctx context.Context, id string) (*domain.RideFareModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	fare, exist := r.rideFares[id]
 	if !exist {
-		return nil, fmt.Errorf("fare does not exist with ID: %s", id)
+		return nil, nil
 	}
 
 	return fare, nil
 }
 
+func (r *inmemRepository) ConsumeRideFare(ctx context.Context, fareID, tripID string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fare, exist := r.rideFares[fareID]
+	if !exist {
+		return domain.ErrFareNotFound
+	}
+
+	if err := fare.CheckUsable(now); err != nil {
+		return err
+	}
+
+	fare.ConsumedAt = &now
+	fare.TripID = tripID
+
+	return nil
+}
+
 func (r *inmemRepository) CreateTrip(ctx context.Context, trip *domain.TripModel) (*domain.TripModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if trip.IdempotencyKey != "" {
+		for _, t := range r.trips {
+			if t.UserID == trip.UserID && t.IdempotencyKey == trip.IdempotencyKey {
+				return nil, domain.ErrDuplicateIdempotencyKey
+			}
+		}
+	}
+
 	r.trips[trip.ID.Hex()] = trip
 	return trip, nil
 }
 
+func (r *inmemRepository) GetTripByIdempotencyKey(ctx context.Context, userID, key string) (*domain.TripModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, t := range r.trips {
+		if t.UserID == userID && t.IdempotencyKey == key {
+			return t, nil
+		}
+	}
+
+	return nil, nil
+}
+
 func (r *inmemRepository) SaveRideFare(ctx context.Context, f *domain.RideFareModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.rideFares[f.ID.Hex()] = f
 	return nil
 }
+
+// WithTransaction doesn't roll anything back: the in memory repository is only meant for local runs
+func (r *inmemRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (r *inmemRepository) SaveOutboxMessage(ctx context.Context, msg *domain.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg.ID = primitive.NewObjectID()
+	r.outbox = append(r.outbox, msg)
+	return nil
+}
+
+func (r *inmemRepository) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*domain.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	lockedUntil := now.Add(lease)
+
+	var messages []*domain.OutboxMessage
+	for _, msg := range r.outbox {
+		if len(messages) == limit {
+			break
+		}
+		if msg.SentAt != nil || (msg.LockedUntil != nil && msg.LockedUntil.After(now)) {
+			continue
+		}
+
+		msg.LockedUntil = &lockedUntil
+		msg.Attempts++
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func (r *inmemRepository) MarkOutboxMessageSent(ctx context.Context, id primitive.ObjectID, sentAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Sent messages are dropped, there is no TTL index to clean them up
+	r.outbox = slices.DeleteFunc(r.outbox, func(msg *domain.OutboxMessage) bool {
+		return msg.ID == id
+	})
+	return nil
+}
+
+func (r *inmemRepository) ReleaseOutboxMessage(ctx context.Context, id primitive.ObjectID, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, msg := range r.outbox {
+		if msg.ID == id {
+			msg.LockedUntil = nil
+			if lastError != "" {
+				msg.LastError = lastError
+			}
+		}
+	}
+	return nil
+}
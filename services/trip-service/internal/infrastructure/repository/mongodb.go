@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"ride-sharing/services/trip-service/internal/domain"
 	"ride-sharing/shared/db"
@@ -11,8 +13,17 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// tripStatusTimestamps maps a trip status to the field recording when the trip entered it
+var tripStatusTimestamps = map[domain.TripStatus]string{
+	domain.TripStatusDriverAssigned: "driverAssignedAt",
+	domain.TripStatusDriverArrived:  "driverArrivedAt",
+	domain.TripStatusInProgress:     "startedAt",
+	domain.TripStatusCompleted:      "completedAt",
+}
+
 type mongoRepository struct {
 	db *mongo.Database
 }
@@ -24,6 +35,10 @@ func NewMongoRepository(db *mongo.Database) *mongoRepository {
 func (r *mongoRepository) CreateTrip(ctx context.Context, trip *domain.TripModel) (*domain.TripModel, error) {
 	result, err := r.db.Collection(db.TripsCollection).InsertOne(ctx, trip)
 	if err != nil {
+		// The only unique index besides _id is the rider's idempotency key
+		if mongo.IsDuplicateKeyError(err) && trip.IdempotencyKey != "" {
+			return nil, domain.ErrDuplicateIdempotencyKey
+		}
 		return nil, err
 	}
 
@@ -32,6 +47,26 @@ func (r *mongoRepository) CreateTrip(ctx context.Context, trip *domain.TripModel
 	return trip, nil
 }
 
+func (r *mongoRepository) GetTripByIdempotencyKey(ctx context.Context, userID, key string) (*domain.TripModel, error) {
+	result := r.db.Collection(db.TripsCollection).FindOne(ctx, bson.M{
+		"userID":         userID,
+		"idempotencyKey": key,
+	})
+	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, result.Err()
+	}
+
+	var trip domain.TripModel
+	if err := result.Decode(&trip); err != nil {
+		return nil, err
+	}
+
+	return &trip, nil
+}
+
 func (r *mongoRepository) GetTripByID(ctx context.Context, id string) (*domain.TripModel, error) {
 	_id, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -40,6 +75,9 @@ func (r *mongoRepository) GetTripByID(ctx context.Context, id string) (*domain.T
 
 	result := r.db.Collection(db.TripsCollection).FindOne(ctx, bson.M{"_id": _id})
 	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
 		return nil, result.Err()
 	}
 
@@ -52,7 +90,7 @@ func (r *mongoRepository) GetTripByID(ctx context.Context, id string) (*domain.T
 	return &trip, nil
 }
 
-func (r *mongoRepository) UpdateTrip(ctx context.Context, tripID string, status string, driver *pbd.Driver) error {
+func (r *mongoRepository) UpdateTrip(ctx context.Context, tripID string, status domain.TripStatus, driver *pbd.Driver) error {
 	_id, err := primitive.ObjectIDFromHex(tripID)
 	if err != nil {
 		return err
@@ -60,22 +98,114 @@ func (r *mongoRepository) UpdateTrip(ctx context.Context, tripID string, status
 
 	update := bson.M{"$set": bson.M{"status": status}}
 
+	if field, ok := tripStatusTimestamps[status]; ok {
+		update["$set"].(bson.M)[field] = time.Now()
+	}
+
 	if driver != nil {
 		update["$set"].(bson.M)["driver"] = driver
 	}
 
-	result, err := r.db.Collection(db.TripsCollection).UpdateOne(ctx, bson.M{"_id": _id}, update)
+	return r.transitionTrip(ctx, _id, status, update)
+}
+
+func (r *mongoRepository) CancelTrip(ctx context.Context, tripID string, cancellation *domain.TripCancellation) error {
+	_id, err := primitive.ObjectIDFromHex(tripID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{
+		"status":       domain.TripStatusCancelled,
+		"cancellation": cancellation,
+	}}
+
+	return r.transitionTrip(ctx, _id, domain.TripStatusCancelled, update)
+}
+
+func (r *mongoRepository) CompleteTrip(ctx context.Context, tripID string, completion *domain.TripCompletion) error {
+	_id, err := primitive.ObjectIDFromHex(tripID)
 	if err != nil {
 		return err
 	}
 
-	if result.ModifiedCount == 0 {
-		return fmt.Errorf("trip not found: %s", tripID)
+	update := bson.M{"$set": bson.M{
+		"status":      domain.TripStatusCompleted,
+		"completion":  completion,
+		"completedAt": time.Now(),
+	}}
+
+	return r.transitionTrip(ctx, _id, domain.TripStatusCompleted, update)
+}
+
+// transitionTrip applies the update only while the trip is in a status that can move to the new one
+func (r *mongoRepository) transitionTrip(ctx context.Context, _id primitive.ObjectID, status domain.TripStatus, update bson.M) error {
+	filter := bson.M{
+		"_id":    _id,
+		"status": bson.M{"$in": status.AllowedFrom()},
+	}
+
+	result, err := r.db.Collection(db.TripsCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		trip, err := r.GetTripByID(ctx, _id.Hex())
+		if err != nil {
+			return err
+		}
+
+		if trip == nil {
+			return fmt.Errorf("trip not found: %s", _id.Hex())
+		}
+
+		return &domain.TripTransitionError{TripID: _id.Hex(), From: trip.Status, To: status}
 	}
 
 	return nil
 }
 
+func (r *mongoRepository) ListTrips(ctx context.Context, filter *domain.TripFilter) ([]*domain.TripModel, error) {
+	query := bson.M{}
+
+	if filter.UserID != "" {
+		query["userID"] = filter.UserID
+	}
+	if filter.DriverID != "" {
+		query["driver.id"] = filter.DriverID
+	}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if filter.Cursor != "" {
+		cursorID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		query["_id"] = bson.M{"$lt": cursorID}
+	}
+
+	// Object IDs grow with their creation time, so sorting on them lists the newest trips first
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := r.db.Collection(db.TripsCollection).Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var trips []*domain.TripModel
+	if err := cursor.All(ctx, &trips); err != nil {
+		return nil, err
+	}
+
+	return trips, nil
+}
+
 func (r *mongoRepository) SaveRideFare(ctx context.Context, fare *domain.RideFareModel) error {
 	result, err := r.db.Collection(db.RideFaresCollection).InsertOne(ctx, fare)
 	if err != nil {
@@ -95,6 +225,9 @@ func (r *mongoRepository) GetRideFareByID(ctx context.Context, id string) (*doma
 
 	result := r.db.Collection(db.RideFaresCollection).FindOne(ctx, bson.M{"_id": _id})
 	if result.Err() != nil {
+		if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
 		return nil, result.Err()
 	}
 
@@ -106,3 +239,161 @@ func (r *mongoRepository) GetRideFareByID(ctx context.Context, id string) (*doma
 
 	return &fare, nil
 }
+
+func (r *mongoRepository) ConsumeRideFare(ctx context.Context, fareID, tripID string, now time.Time) error {
+	_id, err := primitive.ObjectIDFromHex(fareID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id":        _id,
+		"consumedAt": bson.M{"$exists": false},
+		"expiresAt":  bson.M{"$gt": now},
+	}
+
+	update := bson.M{"$set": bson.M{
+		"consumedAt": now,
+		"tripID":     tripID,
+	}}
+
+	result, err := r.db.Collection(db.RideFaresCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		fare, err := r.GetRideFareByID(ctx, fareID)
+		if err != nil {
+			return err
+		}
+
+		if fare == nil {
+			return domain.ErrFareNotFound
+		}
+
+		if err := fare.CheckUsable(now); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("failed to consume fare %s", fareID)
+	}
+
+	return nil
+}
+
+// EnsureIndexes creates the indexes the repository relies on. Creating an existing index is a no-op.
+func (r *mongoRepository) EnsureIndexes(ctx context.Context) error {
+	// Expired fares are removed an hour after their expiry, so a late booking gets a clear "expired" error
+	// rather than "not found". Booked fares are copied into their trip.
+	if _, err := r.db.Collection(db.RideFaresCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(time.Hour.Seconds())),
+	}); err != nil {
+		return err
+	}
+
+	// A rider can't create two trips with the same idempotency key. Trips without a key are not indexed.
+	if _, err := r.db.Collection(db.TripsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userID", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"idempotencyKey": bson.M{"$type": "string"}}),
+	}); err != nil {
+		return err
+	}
+
+	// Sent outbox messages are kept a day for troubleshooting. Unsent ones have no sentAt and never expire,
+	// and the relay finds them through the same index.
+	_, err := r.db.Collection(db.OutboxCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "sentAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32((24 * time.Hour).Seconds())),
+	})
+	return err
+}
+
+// WithTransaction needs MongoDB to run as a replica set, which transactions require
+func (r *mongoRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := r.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	// The session context carries the transaction to every repository call made with it
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+func (r *mongoRepository) SaveOutboxMessage(ctx context.Context, msg *domain.OutboxMessage) error {
+	result, err := r.db.Collection(db.OutboxCollection).InsertOne(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	msg.ID = result.InsertedID.(primitive.ObjectID)
+
+	return nil
+}
+
+func (r *mongoRepository) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]*domain.OutboxMessage, error) {
+	now := time.Now()
+
+	filter := bson.M{
+		"sentAt": nil,
+		"$or": bson.A{
+			bson.M{"lockedUntil": nil},
+			bson.M{"lockedUntil": bson.M{"$lte": now}},
+		},
+	}
+
+	update := bson.M{
+		"$set": bson.M{"lockedUntil": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	// Object IDs grow with their creation time, so the oldest messages are claimed first
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var messages []*domain.OutboxMessage
+	for len(messages) < limit {
+		result := r.db.Collection(db.OutboxCollection).FindOneAndUpdate(ctx, filter, update, opts)
+		if result.Err() != nil {
+			if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+				break
+			}
+			return messages, result.Err()
+		}
+
+		var msg domain.OutboxMessage
+		if err := result.Decode(&msg); err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, &msg)
+	}
+
+	return messages, nil
+}
+
+func (r *mongoRepository) MarkOutboxMessageSent(ctx context.Context, id primitive.ObjectID, sentAt time.Time) error {
+	_, err := r.db.Collection(db.OutboxCollection).UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":   bson.M{"sentAt": sentAt},
+		"$unset": bson.M{"lockedUntil": "", "lastError": ""},
+	})
+	return err
+}
+
+func (r *mongoRepository) ReleaseOutboxMessage(ctx context.Context, id primitive.ObjectID, lastError string) error {
+	update := bson.M{"$unset": bson.M{"lockedUntil": ""}}
+	if lastError != "" {
+		update["$set"] = bson.M{"lastError": lastError}
+	}
+
+	_, err := r.db.Collection(db.OutboxCollection).UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
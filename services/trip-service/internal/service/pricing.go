@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"ride-sharing/services/trip-service/internal/domain"
+	"ride-sharing/shared/types"
+	"sync"
+	"time"
+)
+
+// FareQuote is the price of a package for a route, and the rules that produced it
+type FareQuote struct {
+	PackageSlug       string
+	TotalPriceInCents float64
+	RuleVersion       string
+	City              string
+}
+
+// QuoteRequest describes the trip to price. Distance is in meters and duration in seconds, as returned by OSRM.
+type QuoteRequest struct {
+	Pickup          *types.Coordinate
+	DistanceMeters  float64
+	DurationSeconds float64
+	At              time.Time
+	SurgeMultiplier float64 // 1 or less means no surge
+}
+
+// PricingEngine prices trips with the latest rules of its source, reloading them in the background
+type PricingEngine struct {
+	source domain.PricingRuleSource
+	rules  *domain.PricingRules
+	mu     sync.RWMutex
+}
+
+// NewPricingEngine starts with the given rules until the source is loaded. The source may be nil.
+func NewPricingEngine(source domain.PricingRuleSource, initial *domain.PricingRules) *PricingEngine {
+	return &PricingEngine{
+		source: source,
+		rules:  initial,
+	}
+}
+
+// Reload replaces the rules with the source's if their version changed. Invalid rules are refused
+// and the current ones are kept.
+func (e *PricingEngine) Reload(ctx context.Context) error {
+	if e.source == nil {
+		return nil
+	}
+
+	rules, err := e.source.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load the pricing rules: %w", err)
+	}
+
+	if err := rules.Validate(); err != nil {
+		return fmt.Errorf("invalid pricing rules %s: %w", rules.Version, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if rules.Version == e.rules.Version {
+		return nil
+	}
+
+	log.Printf("Pricing rules updated from version %s to %s", e.rules.Version, rules.Version)
+	e.rules = rules
+
+	return nil
+}
+
+// Watch reloads the rules every interval until the context is cancelled
+func (e *PricingEngine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Reload(ctx); err != nil {
+				log.Printf("Failed to reload the pricing rules: %v", err)
+			}
+		}
+	}
+}
+
+// QuoteAll prices every package available at the pickup
+func (e *PricingEngine) QuoteAll(req *QuoteRequest) ([]*FareQuote, error) {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	city := rules.CityFor(req.Pickup)
+	if city == nil {
+		return nil, domain.ErrPickupNotServed
+	}
+
+	quotes := make([]*FareQuote, 0, len(city.Packages))
+	for _, p := range city.Packages {
+		quotes = append(quotes, quote(rules.Version, city, p, req))
+	}
+
+	return quotes, nil
+}
+
+// Quote prices a single package
+func (e *PricingEngine) Quote(packageSlug string, req *QuoteRequest) (*FareQuote, error) {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	city := rules.CityFor(req.Pickup)
+	if city == nil {
+		return nil, domain.ErrPickupNotServed
+	}
+
+	for _, p := range city.Packages {
+		if p.PackageSlug == packageSlug {
+			return quote(rules.Version, city, p, req), nil
+		}
+	}
+
+	return nil, fmt.Errorf("package %s is not available in %s", packageSlug, city.City)
+}
+
+func quote(version string, city *domain.CityPricing, p *domain.PackagePricing, req *QuoteRequest) *FareQuote {
+	price := p.BaseFareInCents +
+		req.DistanceMeters/1000*p.PerKmInCents +
+		req.DurationSeconds/60*p.PerMinuteInCents
+
+	// Validate already made sure the timezone loads
+	location, _ := time.LoadLocation(city.Timezone)
+	at := req.At.In(location)
+
+	for _, m := range city.TimeModifiers {
+		if m.Applies(at) {
+			price *= m.Multiplier
+			break
+		}
+	}
+
+	if req.SurgeMultiplier > 1 {
+		price *= req.SurgeMultiplier
+	}
+
+	price = math.Max(price, p.MinimumFareInCents) + p.BookingFeeInCents
+
+	return &FareQuote{
+		PackageSlug:       p.PackageSlug,
+		TotalPriceInCents: math.Round(price),
+		RuleVersion:       version,
+		City:              city.City,
+	}
+}
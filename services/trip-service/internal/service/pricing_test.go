@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"ride-sharing/services/trip-service/internal/domain"
+	"ride-sharing/shared/types"
+	"testing"
+	"time"
+)
+
+var (
+	parisPickup  = &types.Coordinate{Latitude: 48.8566, Longitude: 2.3522}
+	londonPickup = &types.Coordinate{Latitude: 51.5074, Longitude: -0.1278}
+)
+
+func testPricingRules() *domain.PricingRules {
+	return &domain.PricingRules{
+		Version: "v2",
+		Cities: []*domain.CityPricing{
+			{
+				City:     "paris",
+				Geofence: &domain.Geofence{MinLatitude: 48.8, MinLongitude: 2.2, MaxLatitude: 48.9, MaxLongitude: 2.5},
+				Timezone: "Europe/Paris",
+				Packages: []*domain.PackagePricing{
+					{
+						PackageSlug:        "sedan",
+						BaseFareInCents:    300,
+						MinimumFareInCents: 800,
+						BookingFeeInCents:  100,
+						PerKmInCents:       120,
+						PerMinuteInCents:   30,
+					},
+				},
+				TimeModifiers: []*domain.TimeModifier{
+					{Name: "night", StartHour: 22, EndHour: 5, Multiplier: 1.5},
+				},
+			},
+			{
+				City: "default",
+				Packages: []*domain.PackagePricing{
+					{PackageSlug: "sedan", BaseFareInCents: 350, PerKmInCents: 1500, PerMinuteInCents: 15},
+				},
+			},
+		},
+	}
+}
+
+func TestPricingEngineQuote(t *testing.T) {
+	// Paris is UTC+1 in January
+	noon := time.Date(2025, time.January, 15, 11, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		pickup    *types.Coordinate
+		distance  float64
+		duration  float64
+		at        time.Time
+		surge     float64
+		wantCity  string
+		wantPrice float64
+	}{
+		{
+			// 300 + 10km * 120 + 20min * 30, then the booking fee
+			name: "day fare", pickup: parisPickup, distance: 10000, duration: 1200, at: noon,
+			wantCity: "paris", wantPrice: 2200,
+		},
+		{
+			name: "night modifier", pickup: parisPickup, distance: 10000, duration: 1200,
+			at:       time.Date(2025, time.January, 15, 22, 30, 0, 0, time.UTC), // 23:30 in Paris
+			wantCity: "paris", wantPrice: 3250,
+		},
+		{
+			name: "night modifier after midnight", pickup: parisPickup, distance: 10000, duration: 1200,
+			at:       time.Date(2025, time.January, 15, 3, 0, 0, 0, time.UTC), // 04:00 in Paris
+			wantCity: "paris", wantPrice: 3250,
+		},
+		{
+			name: "night modifier ended", pickup: parisPickup, distance: 10000, duration: 1200,
+			at:       time.Date(2025, time.January, 15, 4, 0, 0, 0, time.UTC), // 05:00 in Paris
+			wantCity: "paris", wantPrice: 2200,
+		},
+		{
+			// The booking fee is not surged
+			name: "surge", pickup: parisPickup, distance: 10000, duration: 1200, at: noon, surge: 1.2,
+			wantCity: "paris", wantPrice: 2620,
+		},
+		{
+			name: "surge below 1 is ignored", pickup: parisPickup, distance: 10000, duration: 1200, at: noon, surge: 0.8,
+			wantCity: "paris", wantPrice: 2200,
+		},
+		{
+			name: "minimum fare", pickup: parisPickup, distance: 1000, duration: 60, at: noon,
+			wantCity: "paris", wantPrice: 900,
+		},
+		{
+			name: "fallback city", pickup: londonPickup, distance: 10000, duration: 1200, at: noon,
+			wantCity: "default", wantPrice: 15650,
+		},
+		{
+			name: "no pickup", pickup: nil, distance: 10000, duration: 1200, at: noon,
+			wantCity: "default", wantPrice: 15650,
+		},
+	}
+
+	engine := NewPricingEngine(nil, testPricingRules())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := engine.Quote("sedan", &QuoteRequest{
+				Pickup:          tt.pickup,
+				DistanceMeters:  tt.distance,
+				DurationSeconds: tt.duration,
+				At:              tt.at,
+				SurgeMultiplier: tt.surge,
+			})
+			if err != nil {
+				t.Fatalf("Quote() = %v", err)
+			}
+
+			if q.TotalPriceInCents != tt.wantPrice {
+				t.Errorf("price = %v, want %v", q.TotalPriceInCents, tt.wantPrice)
+			}
+			if q.City != tt.wantCity {
+				t.Errorf("city = %s, want %s", q.City, tt.wantCity)
+			}
+			if q.PackageSlug != "sedan" || q.RuleVersion != "v2" {
+				t.Errorf("quote is for %s with rules %s, want sedan with rules v2", q.PackageSlug, q.RuleVersion)
+			}
+		})
+	}
+}
+
+func TestPricingEngineQuoteErrors(t *testing.T) {
+	withoutFallback := testPricingRules()
+	withoutFallback.Cities = withoutFallback.Cities[:1]
+
+	tests := []struct {
+		name        string
+		rules       *domain.PricingRules
+		packageSlug string
+		pickup      *types.Coordinate
+		wantErr     error
+	}{
+		{"unknown package", testPricingRules(), "helicopter", parisPickup, nil},
+		{"pickup outside of every city", withoutFallback, "sedan", londonPickup, domain.ErrPickupNotServed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewPricingEngine(nil, tt.rules).Quote(tt.packageSlug, &QuoteRequest{
+				Pickup:          tt.pickup,
+				DistanceMeters:  10000,
+				DurationSeconds: 1200,
+				At:              time.Now(),
+			})
+			if err == nil {
+				t.Fatalf("Quote() = %+v, want an error", q)
+			}
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Quote() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
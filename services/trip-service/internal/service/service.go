@@ -13,30 +13,63 @@ import (
 	pbd "ride-sharing/shared/proto/driver"
 	"ride-sharing/shared/proto/trip"
 	"ride-sharing/shared/types"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type service struct {
-	repo domain.TripRepository
+	repo      domain.TripRepository
+	publisher domain.TripEventPublisher
+	pricing   *PricingEngine
+	surge     *SurgePricer
 }
 
-func NewService(repo domain.TripRepository) *service {
+func NewService(repo domain.TripRepository, publisher domain.TripEventPublisher, pricing *PricingEngine, surge *SurgePricer) *service {
 	return &service{
-		repo: repo,
+		repo:      repo,
+		publisher: publisher,
+		pricing:   pricing,
+		surge:     surge,
 	}
 }
 
-func (s *service) CreateTrip(ctx context.Context, fare *domain.RideFareModel) (*domain.TripModel, error) {
+func (s *service) CreateTrip(ctx context.Context, fare *domain.RideFareModel, idempotencyKey string) (*domain.TripModel, error) {
 	t := &domain.TripModel{
-		ID:       primitive.NewObjectID(),
-		UserID:   fare.UserID,
-		Status:   "pending",
-		RideFare: fare,
-		Driver:   &trip.TripDriver{},
+		ID:             primitive.NewObjectID(),
+		UserID:         fare.UserID,
+		Status:         domain.TripStatusRequested,
+		RideFare:       fare,
+		Driver:         &trip.TripDriver{},
+		IdempotencyKey: idempotencyKey,
 	}
 
-	return s.repo.CreateTrip(ctx, t)
+	var trip *domain.TripModel
+	err := s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		// Claim the fare first, so concurrent requests with the same fare can't both create a trip
+		now := time.Now()
+		if err := s.repo.ConsumeRideFare(ctx, fare.ID.Hex(), t.ID.Hex(), now); err != nil {
+			return err
+		}
+
+		fare.ConsumedAt = &now
+		fare.TripID = t.ID.Hex()
+
+		var err error
+		trip, err = s.repo.CreateTrip(ctx, t)
+		if err != nil {
+			return err
+		}
+
+		return s.publisher.PublishTripStatusChanged(ctx, trip)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.surge.RecordRequest(fare.Pickup)
+
+	return trip, nil
 }
 
 func (s *service) GetRoute(ctx context.Context, pickup, destination *types.Coordinate, useOSRMApi bool) (*tripTypes.OsrmApiResponse, error) {
@@ -99,19 +132,38 @@ func (s *service) GetRoute(ctx context.Context, pickup, destination *types.Coord
 	return &routeResp, nil
 }
 
-func (s *service) EstimatePackagesPriceWithRoute(route *tripTypes.OsrmApiResponse) []*domain.RideFareModel {
-	baseFares := getBaseFares()
-	estimatedFares := make([]*domain.RideFareModel, len(baseFares))
+func (s *service) EstimatePackagesPriceWithRoute(ctx context.Context, route *tripTypes.OsrmApiResponse, pickup *types.Coordinate) ([]*domain.RideFareModel, error) {
+	area, multiplier := s.surge.Multiplier(ctx, pickup)
 
-	for i, f := range baseFares {
-		estimatedFares[i] = estimateFareRoute(f, route)
+	quotes, err := s.pricing.QuoteAll(&QuoteRequest{
+		Pickup:          pickup,
+		DistanceMeters:  route.Routes[0].Distance,
+		DurationSeconds: route.Routes[0].Duration,
+		At:              time.Now(),
+		SurgeMultiplier: multiplier,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return estimatedFares
+	estimatedFares := make([]*domain.RideFareModel, len(quotes))
+	for i, q := range quotes {
+		estimatedFares[i] = &domain.RideFareModel{
+			PackageSlug:       q.PackageSlug,
+			TotalPriceInCents: q.TotalPriceInCents,
+			SurgeMultiplier:   multiplier,
+			SurgeArea:         area,
+			PricingVersion:    q.RuleVersion,
+			PricingCity:       q.City,
+		}
+	}
+
+	return estimatedFares, nil
 }
 
-func (s *service) GenerateTripFares(ctx context.Context, rideFares []*domain.RideFareModel, userID string, route *tripTypes.OsrmApiResponse) ([]*domain.RideFareModel, error) {
+func (s *service) GenerateTripFares(ctx context.Context, rideFares []*domain.RideFareModel, userID string, route *tripTypes.OsrmApiResponse, pickup, destination *types.Coordinate) ([]*domain.RideFareModel, error) {
 	fares := make([]*domain.RideFareModel, len(rideFares))
+	now := time.Now()
 
 	for i, f := range rideFares {
 		id := primitive.NewObjectID()
@@ -122,6 +174,14 @@ func (s *service) GenerateTripFares(ctx context.Context, rideFares []*domain.Rid
 			TotalPriceInCents: f.TotalPriceInCents,
 			PackageSlug:       f.PackageSlug,
 			Route:             route,
+			Pickup:            pickup,
+			Destination:       destination,
+			SurgeMultiplier:   f.SurgeMultiplier,
+			SurgeArea:         f.SurgeArea,
+			PricingVersion:    f.PricingVersion,
+			PricingCity:       f.PricingCity,
+			CreatedAt:         now,
+			ExpiresAt:         now.Add(domain.RideFareTTL),
 		}
 
 		if err := s.repo.SaveRideFare(ctx, fare); err != nil {
@@ -141,59 +201,269 @@ func (s *service) GetAndValidateFare(ctx context.Context, fareID, userID string)
 	}
 
 	if fare == nil {
-		return nil, fmt.Errorf("fare does not exist")
+		return nil, domain.ErrFareNotFound
 	}
 
 	// User fare validation (user is owner of this fare?)
 	if userID != fare.UserID {
-		return nil, fmt.Errorf("fare does not belong to the user")
+		return nil, domain.ErrFareNotOwned
+	}
+
+	if err := fare.CheckUsable(time.Now()); err != nil {
+		return nil, err
 	}
 
 	return fare, nil
 }
 
-func estimateFareRoute(f *domain.RideFareModel, route *tripTypes.OsrmApiResponse) *domain.RideFareModel {
-	pricingCfg := tripTypes.DefaultPricingConfig()
-	carPackagePrice := f.TotalPriceInCents
+func (s *service) GetTripByID(ctx context.Context, id string) (*domain.TripModel, error) {
+	return s.repo.GetTripByID(ctx, id)
+}
 
-	distanceKm := route.Routes[0].Distance
-	durationInMinutes := route.Routes[0].Duration
+func (s *service) GetTripByIdempotencyKey(ctx context.Context, userID, key string) (*domain.TripModel, error) {
+	return s.repo.GetTripByIdempotencyKey(ctx, userID, key)
+}
+
+func (s *service) UpdateTrip(ctx context.Context, tripID string, status domain.TripStatus, driver *pbd.Driver) (*domain.TripModel, error) {
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
 
-	distanceFare := distanceKm * pricingCfg.PricePerUnitOfDistance
-	timeFare := durationInMinutes * pricingCfg.PricingPerMinute
-	totalPrice := carPackagePrice + distanceFare + timeFare
+	if trip == nil {
+		return nil, fmt.Errorf("trip not found: %s", tripID)
+	}
 
-	return &domain.RideFareModel{
-		TotalPriceInCents: totalPrice,
-		PackageSlug:       f.PackageSlug,
+	if err := domain.ValidateTransition(tripID, trip.Status, status); err != nil {
+		return nil, err
 	}
+
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		// The repository re-checks the transition atomically, so a concurrent update cannot slip through
+		if err := s.repo.UpdateTrip(ctx, tripID, status, driver); err != nil {
+			return err
+		}
+
+		trip, err = s.repo.GetTripByID(ctx, tripID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.publisher.PublishTripStatusChanged(ctx, trip); err != nil {
+			return fmt.Errorf("failed to publish the trip status change: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trip, nil
 }
 
-func getBaseFares() []*domain.RideFareModel {
-	return []*domain.RideFareModel{
-		{
-			PackageSlug:       "suv",
-			TotalPriceInCents: 200,
-		},
-		{
-			PackageSlug:       "sedan",
-			TotalPriceInCents: 350,
-		},
-		{
-			PackageSlug:       "van",
-			TotalPriceInCents: 400,
-		},
-		{
-			PackageSlug:       "luxury",
-			TotalPriceInCents: 1000,
-		},
+func (s *service) CancelTrip(ctx context.Context, tripID, userID, reason string) (*domain.TripModel, error) {
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	if trip == nil {
+		return nil, fmt.Errorf("trip not found: %s", tripID)
+	}
+
+	// Only the rider and the assigned driver are allowed to cancel
+	var cancelledBy string
+	switch {
+	case userID == trip.UserID:
+		cancelledBy = domain.CancelledByRider
+	case trip.HasDriver() && userID == trip.Driver.Id:
+		cancelledBy = domain.CancelledByDriver
+	default:
+		return nil, domain.ErrNotTripParticipant
+	}
+
+	if err := domain.ValidateTransition(tripID, trip.Status, domain.TripStatusCancelled); err != nil {
+		return nil, err
+	}
+
+	cancellation := &domain.TripCancellation{
+		CancelledBy: cancelledBy,
+		UserID:      userID,
+		Reason:      reason,
+		CancelledAt: time.Now(),
 	}
+
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.CancelTrip(ctx, tripID, cancellation); err != nil {
+			return err
+		}
+
+		trip, err = s.repo.GetTripByID(ctx, tripID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.publisher.PublishTripStatusChanged(ctx, trip); err != nil {
+			return fmt.Errorf("failed to publish the trip cancellation: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trip, nil
 }
 
-func (s *service) GetTripByID(ctx context.Context, id string) (*domain.TripModel, error) {
-	return s.repo.GetTripByID(ctx, id)
+func (s *service) UpdateTripProgress(ctx context.Context, tripID, driverID string, status domain.TripStatus) (*domain.TripModel, error) {
+	if _, err := s.getDriverTrip(ctx, tripID, driverID); err != nil {
+		return nil, err
+	}
+
+	return s.UpdateTrip(ctx, tripID, status, nil)
+}
+
+func (s *service) CompleteTrip(ctx context.Context, tripID, driverID string, distance, duration float64) (*domain.TripModel, error) {
+	trip, err := s.getDriverTrip(ctx, tripID, driverID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := domain.ValidateTransition(tripID, trip.Status, domain.TripStatusCompleted); err != nil {
+		return nil, err
+	}
+
+	// The measures come from the driver app: they are capped to what the quoted route allows
+	distance, duration = capTripMeasures(trip, distance, duration)
+
+	// Charge what was actually driven, falling back to the quoted fare if the driver app didn't measure it
+	completion := &domain.TripCompletion{
+		Distance:          distance,
+		Duration:          duration,
+		TotalPriceInCents: trip.RideFare.TotalPriceInCents,
+		PricingVersion:    trip.RideFare.PricingVersion,
+	}
+
+	if distance > 0 && duration > 0 {
+		// The surge and time of day of the request still apply, with the current rules
+		q, err := s.pricing.Quote(trip.RideFare.PackageSlug, &QuoteRequest{
+			Pickup:          trip.RideFare.Pickup,
+			DistanceMeters:  distance,
+			DurationSeconds: duration,
+			At:              trip.ID.Timestamp(),
+			SurgeMultiplier: trip.RideFare.SurgeMultiplier,
+		})
+		if err != nil {
+			log.Printf("Failed to price trip %s, charging the quoted fare: %v", tripID, err)
+		} else {
+			completion.TotalPriceInCents = q.TotalPriceInCents
+			completion.PricingVersion = q.RuleVersion
+		}
+	}
+
+	err = s.repo.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.CompleteTrip(ctx, tripID, completion); err != nil {
+			return err
+		}
+
+		trip, err = s.repo.GetTripByID(ctx, tripID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.publisher.PublishTripStatusChanged(ctx, trip); err != nil {
+			return fmt.Errorf("failed to publish the trip completion: %w", err)
+		}
+
+		// The final price is known -> ask the payment service for a checkout session
+		if err := s.publisher.PublishPaymentSessionRequested(ctx, trip); err != nil {
+			return fmt.Errorf("failed to request the trip payment: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trip, nil
 }
 
-func (s *service) UpdateTrip(ctx context.Context, tripID string, status string, driver *pbd.Driver) error {
-	return s.repo.UpdateTrip(ctx, tripID, status, driver)
+// Bounds of the driven distance and duration, relative to the quoted route: detours and traffic make
+// them longer, the slack covers the short trips
+const (
+	maxDistanceFactor = 1.5
+	maxDistanceSlack  = 2000 // meters
+	maxDurationFactor = 3
+	maxDurationSlack  = 15 * 60 // seconds
+)
+
+// capTripMeasures limits the distance and duration reported by the driver to the bounds of the quoted route.
+// Without a quoted route they are dropped, so the quoted fare is charged.
+func capTripMeasures(trip *domain.TripModel, distance, duration float64) (float64, float64) {
+	if trip.RideFare == nil || trip.RideFare.Route == nil || len(trip.RideFare.Route.Routes) == 0 {
+		return 0, 0
+	}
+
+	quoted := trip.RideFare.Route.Routes[0]
+	maxDistance := max(quoted.Distance*maxDistanceFactor, quoted.Distance+maxDistanceSlack)
+	maxDuration := max(quoted.Duration*maxDurationFactor, quoted.Duration+maxDurationSlack)
+
+	if distance > maxDistance || duration > maxDuration {
+		log.Printf("Trip %s reported %.0fm in %.0fs, capping to %.0fm in %.0fs", trip.ID.Hex(), distance, duration, maxDistance, maxDuration)
+	}
+
+	return min(distance, maxDistance), min(duration, maxDuration)
+}
+
+// getDriverTrip fetches the trip and makes sure it is assigned to the given driver
+func (s *service) getDriverTrip(ctx context.Context, tripID, driverID string) (*domain.TripModel, error) {
+	trip, err := s.repo.GetTripByID(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	if trip == nil {
+		return nil, fmt.Errorf("trip not found: %s", tripID)
+	}
+
+	if !trip.HasDriver() || trip.Driver.Id != driverID {
+		return nil, domain.ErrNotTripParticipant
+	}
+
+	return trip, nil
+}
+
+const (
+	defaultTripsPageSize = 20
+	maxTripsPageSize     = 100
+)
+
+func (s *service) ListTrips(ctx context.Context, filter *domain.TripFilter) ([]*domain.TripModel, string, error) {
+	pageSize := filter.Limit
+	if pageSize <= 0 {
+		pageSize = defaultTripsPageSize
+	}
+	if pageSize > maxTripsPageSize {
+		pageSize = maxTripsPageSize
+	}
+
+	// Fetch one extra trip to know whether there is a next page
+	f := *filter
+	f.Limit = pageSize + 1
+
+	trips, err := s.repo.ListTrips(ctx, &f)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list trips: %w", err)
+	}
+
+	if len(trips) <= pageSize {
+		return trips, "", nil
+	}
+
+	trips = trips[:pageSize]
+
+	return trips, trips[pageSize-1].ID.Hex(), nil
 }
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"ride-sharing/services/trip-service/internal/domain"
+	"ride-sharing/shared/types"
+	"sync"
+	"time"
+
+	"github.com/mmcloughlin/geohash"
+)
+
+// SurgeConfig controls how fares go up when there are more trip requests than drivers in an area
+type SurgeConfig struct {
+	Precision       uint          // geohash length of the surge areas (5 is ~4.9km x 4.9km)
+	DemandWindow    time.Duration // how far back trip requests are counted
+	Sensitivity     float64       // how much the multiplier grows per request above the number of drivers, per driver
+	MaxMultiplier   float64
+	SmoothingWindow time.Duration // how long the multiplier takes to move most of the way to a new target
+}
+
+func DefaultSurgeConfig() *SurgeConfig {
+	return &SurgeConfig{
+		Precision:       5,
+		DemandWindow:    10 * time.Minute,
+		Sensitivity:     0.5,
+		MaxMultiplier:   3,
+		SmoothingWindow: 2 * time.Minute,
+	}
+}
+
+type surgeArea struct {
+	requests   []time.Time // trip requests within the demand window, oldest first
+	multiplier float64
+	updatedAt  time.Time
+}
+
+// SurgePricer keeps a smoothed surge multiplier per geohash area, from the recent trip requests
+// it was told about and the drivers currently online there.
+type SurgePricer struct {
+	supply domain.DriverSupply
+	cfg    *SurgeConfig
+	areas  map[string]*surgeArea
+	// sweptAt is the last time the quiet areas were forgotten, see sweep
+	sweptAt time.Time
+	mu      sync.Mutex
+}
+
+func NewSurgePricer(supply domain.DriverSupply, cfg *SurgeConfig) *SurgePricer {
+	return &SurgePricer{
+		supply:  supply,
+		cfg:     cfg,
+		areas:   make(map[string]*surgeArea),
+		sweptAt: time.Now(),
+	}
+}
+
+// RecordRequest counts a trip requested from the location towards the demand of its area
+func (p *SurgePricer) RecordRequest(location *types.Coordinate) {
+	if location == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	area := p.area(p.areaOf(location))
+	area.requests = append(area.requests, time.Now())
+}
+
+// Multiplier returns the area of the location and its current surge multiplier, 1 meaning no surge
+func (p *SurgePricer) Multiplier(ctx context.Context, location *types.Coordinate) (string, float64) {
+	if location == nil {
+		return "", 1
+	}
+
+	areaHash := p.areaOf(location)
+
+	// Ask for the supply outside of the lock, it is a network call
+	drivers, err := p.supply.AvailableDrivers(ctx, areaHash)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.sweep(now)
+
+	area := p.area(areaHash)
+
+	if err != nil {
+		// Keep quoting the last known multiplier rather than failing the preview
+		log.Printf("Failed to get the driver supply of area %s: %v", areaHash, err)
+		return areaHash, roundMultiplier(area.multiplier)
+	}
+
+	p.update(area, drivers, now)
+
+	return areaHash, roundMultiplier(area.multiplier)
+}
+
+// update moves the multiplier of the area towards its target. Callers must hold p.mu.
+func (p *SurgePricer) update(area *surgeArea, drivers int, now time.Time) {
+	p.forgetRequests(area, now)
+
+	target := p.target(len(area.requests), drivers)
+
+	// Exponential smoothing over time, so the price doesn't jump from one preview to the next
+	alpha := 1 - math.Exp(-float64(now.Sub(area.updatedAt))/float64(p.cfg.SmoothingWindow))
+	area.multiplier += alpha * (target - area.multiplier)
+	area.updatedAt = now
+}
+
+// forgetRequests drops the requests of the area that left the demand window. Callers must hold p.mu.
+func (p *SurgePricer) forgetRequests(area *surgeArea, now time.Time) {
+	cutoff := now.Add(-p.cfg.DemandWindow)
+	kept := 0
+	for kept < len(area.requests) && area.requests[kept].Before(cutoff) {
+		kept++
+	}
+	area.requests = area.requests[kept:]
+}
+
+// sweep forgets the areas without requests in the demand window once their multiplier settled back
+// to 1, at most once per window. Callers must hold p.mu.
+func (p *SurgePricer) sweep(now time.Time) {
+	if now.Sub(p.sweptAt) < p.cfg.DemandWindow {
+		return
+	}
+	p.sweptAt = now
+
+	for hash, area := range p.areas {
+		p.forgetRequests(area, now)
+		if len(area.requests) > 0 {
+			continue
+		}
+
+		// Without requests the target is 1 whatever the supply
+		p.update(area, 0, now)
+		if roundMultiplier(area.multiplier) == 1 {
+			delete(p.areas, hash)
+		}
+	}
+}
+
+// roundMultiplier rounds the multiplier to the 2 decimals fares are quoted with
+func roundMultiplier(multiplier float64) float64 {
+	return math.Round(multiplier*100) / 100
+}
+
+// target is the multiplier the area would have without smoothing
+func (p *SurgePricer) target(requests, drivers int) float64 {
+	ratio := float64(requests) / math.Max(float64(drivers), 1)
+	if ratio <= 1 {
+		return 1
+	}
+
+	return math.Min(1+p.cfg.Sensitivity*(ratio-1), p.cfg.MaxMultiplier)
+}
+
+func (p *SurgePricer) areaOf(location *types.Coordinate) string {
+	return geohash.EncodeWithPrecision(location.Latitude, location.Longitude, p.cfg.Precision)
+}
+
+// area returns the state of the area, creating it without surge. Callers must hold p.mu.
+func (p *SurgePricer) area(hash string) *surgeArea {
+	area, ok := p.areas[hash]
+	if !ok {
+		area = &surgeArea{multiplier: 1, updatedAt: time.Now()}
+		p.areas[hash] = area
+	}
+	return area
+}
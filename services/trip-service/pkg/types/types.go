@@ -33,15 +33,3 @@ func (o *OsrmApiResponse) ToProto() *pb.Route {
 		Duration: route.Duration,
 	}
 }
-
-type PricingConfig struct {
-	PricePerUnitOfDistance float64
-	PricingPerMinute       float64
-}
-
-func DefaultPricingConfig() *PricingConfig {
-	return &PricingConfig{
-		PricePerUnitOfDistance: 1.5,
-		PricingPerMinute:       0.25,
-	}
-}
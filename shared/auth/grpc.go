@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys of the identity. The services are only reachable inside the cluster, they trust the
+// identity the gateway verified.
+const (
+	userIDMetadataKey = "x-user-id"
+	roleMetadataKey   = "x-user-role"
+)
+
+// WithIdentityInterceptors reads the identity sent by the caller into the context of the handlers
+func WithIdentityInterceptors() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryServerInterceptor),
+	}
+}
+
+// DialOptionsWithIdentity sends the identity of the context along with every call
+func DialOptionsWithIdentity() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryClientInterceptor),
+	}
+}
+
+func unaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if identity := FromContext(ctx); identity != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			userIDMetadataKey, identity.UserID,
+			roleMetadataKey, string(identity.Role),
+		)
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func unaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if identity := identityFromMetadata(ctx); identity != nil {
+		ctx = WithIdentity(ctx, identity)
+	}
+
+	return handler(ctx, req)
+}
+
+// identityFromMetadata returns nil when the call comes from another service, without a user
+func identityFromMetadata(ctx context.Context) *Identity {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	userIDs := md.Get(userIDMetadataKey)
+	roles := md.Get(roleMetadataKey)
+	if len(userIDs) != 1 || len(roles) != 1 || userIDs[0] == "" {
+		return nil
+	}
+
+	role := Role(roles[0])
+	if !role.IsValid() {
+		return nil
+	}
+
+	return &Identity{
+		UserID: userIDs[0],
+		Role:   role,
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Package auth carries the authenticated user between the services. The api-gateway verifies the JWT of
+each request and passes the identity it holds to the services as gRPC metadata, the services check that
+the user owns what it asks for.
+*/
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Role string
+
+const (
+	RoleRider  Role = "rider"
+	RoleDriver Role = "driver"
+	// RoleAdmin acts on behalf of any user
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleRider, RoleDriver, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Identity is the authenticated user of a request
+type Identity struct {
+	UserID string
+	Role   Role
+}
+
+func (i *Identity) IsAdmin() bool {
+	return i.Role == RoleAdmin
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the authenticated user of the request, or nil for the calls between services
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+// RequireOwner checks that the request is made by one of the owners, or by an admin. It returns
+// an Unauthenticated status without an identity and a PermissionDenied one for another user.
+func RequireOwner(ctx context.Context, ownerIDs ...string) error {
+	identity := FromContext(ctx)
+	if identity == nil {
+		return status.Error(codes.Unauthenticated, "the request has no authenticated user")
+	}
+
+	if identity.IsAdmin() {
+		return nil
+	}
+
+	for _, id := range ownerIDs {
+		if id != "" && id == identity.UserID {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "user %s is not allowed to act on behalf of another user", identity.UserID)
+}
@@ -1,9 +1,19 @@
 package contracts
 
-// AmqpMessage is the message structure for AMQP.
+import "time"
+
+// AmqpMessage is the envelope of every AMQP message. Data holds the JSON payload, whose type is
+// registered per routing key and schema version in shared/messaging.
 type AmqpMessage struct {
-	OwnerID string `json:"ownerId"`
-	Data    []byte `json:"data"`
+	EventID       string    `json:"eventId,omitempty" bson:"eventId"`
+	EventType     string    `json:"eventType,omitempty" bson:"eventType"` // the routing key
+	SchemaVersion int       `json:"schemaVersion,omitempty" bson:"schemaVersion"`
+	OccurredAt    time.Time `json:"occurredAt" bson:"occurredAt"`
+	Producer      string    `json:"producer,omitempty" bson:"producer"`           // the service that published the message
+	CorrelationID string    `json:"correlationId,omitempty" bson:"correlationId"` // the first message of the flow
+	CausationID   string    `json:"causationId,omitempty" bson:"causationId"`     // the message being handled when this one was published
+	OwnerID       string    `json:"ownerId" bson:"ownerId"`
+	Data          []byte    `json:"data" bson:"data"`
 }
 
 // Routing keys - using consistent event/command patterns
@@ -13,13 +23,25 @@ const (
 	TripEventDriverAssigned      = "trip.event.driver_assigned"
 	TripEventNoDriversFound      = "trip.event.no_drivers_found"
 	TripEventDriverNotInterested = "trip.event.driver_not_interested"
+	TripEventDriverArrived       = "trip.event.driver_arrived"
+	TripEventStarted             = "trip.event.started"
+	TripEventCompleted           = "trip.event.completed"
+	TripEventPaid                = "trip.event.paid"
+	TripEventCancelled           = "trip.event.cancelled"
+	TripEventExpired             = "trip.event.expired"
+	TripEventDriverLocation      = "trip.event.driver_location"
 
 	// Driver commands (driver.cmd.*)
-	DriverCmdTripRequest = "driver.cmd.trip_request"
-	DriverCmdTripAccept  = "driver.cmd.trip_accept"
-	DriverCmdTripDecline = "driver.cmd.trip_decline"
-	DriverCmdLocation    = "driver.cmd.location"
-	DriverCmdRegister    = "driver.cmd.register"
+	DriverCmdTripRequest  = "driver.cmd.trip_request"
+	DriverCmdTripAccept   = "driver.cmd.trip_accept"
+	DriverCmdTripDecline  = "driver.cmd.trip_decline"
+	DriverCmdTripCancel   = "driver.cmd.trip_cancel"
+	DriverCmdArrived      = "driver.cmd.arrived"
+	DriverCmdTripStart    = "driver.cmd.trip_start"
+	DriverCmdTripComplete = "driver.cmd.trip_complete"
+	DriverCmdLocation     = "driver.cmd.location"
+	DriverCmdRegister     = "driver.cmd.register"
+	DriverCmdSetStatus    = "driver.cmd.set_status"
 
 	// Payment events (payment.event.*)
 	PaymentEventSessionCreated = "payment.event.session_created"
@@ -6,6 +6,9 @@ import "encoding/json"
 type WSMessage struct {
 	Type string `json:"type"`
 	Data any    `json:"data"`
+	// Seq numbers the notifications of a user, the client sends the last one it received when it reconnects
+	// to get the ones it missed. Messages that are not kept for offline users have none.
+	Seq uint64 `json:"seq,omitempty"`
 }
 
 type WSDriverMessage struct {
@@ -2,19 +2,31 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 const (
-	TripsCollection     = "trips"
-	RideFaresCollection = "ride_fares"
+	TripsCollection        = "trips"
+	RideFaresCollection    = "ride_fares"
+	PricingRulesCollection = "pricing_rules"
+	OutboxCollection       = "trip_outbox"
+	InboxCollection        = "message_inbox"
+	PresenceCollection     = "gateway_presence"
+	MailboxCollection      = "gateway_mailbox"
+	MailboxSeqCollection   = "gateway_mailbox_seq"
+
+	DispatchOffersCollection = "dispatch_offers"
+	DriverProfilesCollection = "driver_profiles"
+	DriverSessionsCollection = "driver_sessions"
 )
 
 // MongoConfig holds MongoDB connection configuration
@@ -60,3 +72,21 @@ func NewMongoClient(ctx context.Context, cfg *MongoConfig) (*mongo.Client, error
 func GetDatabase(client *mongo.Client, cfg *MongoConfig) *mongo.Database {
 	return client.Database(cfg.Database)
 }
+
+// RequireTransactions checks that the server supports multi-document transactions: they need a replica set,
+// a single node one is enough, or a sharded cluster
+func RequireTransactions(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("failed to check the MongoDB topology: %w", err)
+	}
+
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return errors.New("MongoDB must run as a replica set for transactions, start it with --replSet and add replicaSet=<name> to MONGODB_URI")
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"ride-sharing/shared/contracts"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrSendQueueFull = errors.New("send queue is full")
+
+// ConnectionConfig controls the keepalive of the WebSocket connections
+type ConnectionConfig struct {
+	PingInterval  time.Duration
+	PongTimeout   time.Duration // a client that answers no ping for this long is disconnected, longer than PingInterval
+	WriteTimeout  time.Duration // a write taking longer disconnects the client
+	SendQueueSize int           // messages waiting to be written, a client falling further behind is disconnected
+}
+
+func DefaultConnectionConfig() *ConnectionConfig {
+	return &ConnectionConfig{
+		PingInterval: 10 * time.Second,
+		PongTimeout:  25 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		// More than the mailbox keeps, so a replay fits
+		SendQueueSize: 256,
+	}
+}
+
+// connWrapper is a wrapper around the websocket connection to allow for thread-safe operations.
+// Its write pump is the only goroutine writing to the connection, the others queue their messages.
+type connWrapper struct {
+	conn      *websocket.Conn
+	send      chan contracts.WSMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnWrapper(conn *websocket.Conn, queueSize int) *connWrapper {
+	return &connWrapper{
+		conn: conn,
+		send: make(chan contracts.WSMessage, queueSize),
+		done: make(chan struct{}),
+	}
+}
+
+// close stops the write pump. It is called once the wrapper is out of the connection map,
+// so no message is queued afterwards.
+func (w *connWrapper) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+// keepAlive sets up the read deadline of a new connection: every pong extends it, so a client that stops
+// answering the pings fails its next read and its handler returns. It must be called before the first read.
+func (cm *ConnectionManager) keepAlive(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(cm.cfg.PongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(cm.cfg.PongTimeout))
+	})
+}
+
+// writePump writes the queued messages and pings the client until the connection is removed or a write fails
+func (cm *ConnectionManager) writePump(id string, w *connWrapper) {
+	ticker := time.NewTicker(cm.cfg.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-w.send:
+			w.conn.SetWriteDeadline(time.Now().Add(cm.cfg.WriteTimeout))
+			if err := w.conn.WriteJSON(message); err != nil {
+				log.Printf("Failed to write to user %s, disconnecting it: %v", id, err)
+				cm.disconnect(id, w, message)
+				return
+			}
+		case <-ticker.C:
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cm.cfg.WriteTimeout)); err != nil {
+				log.Printf("Failed to ping user %s, disconnecting it: %v", id, err)
+				cm.disconnect(id, w)
+				return
+			}
+		case <-w.done:
+			cm.keepUnsent(id, w)
+			return
+		}
+	}
+}
+
+// disconnect closes the connection, which ends the read loop of its handler, and keeps the messages
+// it couldn't send
+func (cm *ConnectionManager) disconnect(id string, w *connWrapper, unsent ...contracts.WSMessage) {
+	w.conn.Close()
+
+	// Removed first, so nothing is queued while the queue is drained
+	cm.Remove(id, w.conn)
+	cm.keepUnsent(id, w, unsent...)
+}
+
+// keepUnsent moves the queued numbered messages to the mailbox, the client gets them back when it reconnects
+func (cm *ConnectionManager) keepUnsent(id string, w *connWrapper, unsent ...contracts.WSMessage) {
+	for len(w.send) > 0 {
+		unsent = append(unsent, <-w.send)
+	}
+
+	mailbox := cm.getMailbox()
+	if mailbox == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cm.cfg.WriteTimeout)
+	defer cancel()
+
+	for _, message := range unsent {
+		if message.Seq == 0 {
+			continue
+		}
+		if err := mailbox.Put(ctx, id, message); err != nil {
+			log.Printf("Failed to keep unsent message %d for user %s: %v", message.Seq, id, err)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package messaging
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
@@ -9,21 +12,18 @@ import (
 	"ride-sharing/shared/contracts"
 
 	"github.com/gorilla/websocket"
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 var (
 	ErrConnectionNotFound = errors.New("connection not found")
 )
 
-// connWrapper is a wrapper around the websocket connection to allow for thread-safe operations
-// This is necessary because the websocket connection is not thread-safe
-type connWrapper struct {
-	conn  *websocket.Conn
-	mutex sync.Mutex
-}
-
 type ConnectionManager struct {
+	cfg         *ConnectionConfig
 	connections map[string]*connWrapper // Local connections storage (userId -> connection)
+	presence    *presence               // Shares the connections with the other instances, see EnablePresence
+	mailbox     MailboxStore            // Keeps the messages of the offline users, see UseMailbox
 	mutex       sync.RWMutex
 }
 
@@ -33,9 +33,10 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// Note that on multiple instances of the API gateway, the connection manager needs to store the connections on a separate shared storage.
-func NewConnectionManager() *ConnectionManager {
+// On multiple instances of the API gateway, EnablePresence routes the messages to the instance holding the connection
+func NewConnectionManager(cfg *ConnectionConfig) *ConnectionManager {
 	return &ConnectionManager{
+		cfg:         cfg,
 		connections: make(map[string]*connWrapper),
 	}
 }
@@ -48,21 +49,51 @@ func (cm *ConnectionManager) Upgrade(w http.ResponseWriter, r *http.Request) (*w
 	return conn, nil
 }
 
+// Add starts writing and pinging the connection. It is called before the handler reads from it.
 func (cm *ConnectionManager) Add(id string, conn *websocket.Conn) {
+	cm.keepAlive(conn)
+
+	wrapper := newConnWrapper(conn, cm.cfg.SendQueueSize)
+
 	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
-	cm.connections[id] = &connWrapper{
-		conn:  conn,
-		mutex: sync.Mutex{},
+	replaced := cm.connections[id]
+	cm.connections[id] = wrapper
+	p := cm.presence
+	cm.mutex.Unlock()
+
+	if replaced != nil {
+		replaced.close()
+	}
+
+	go cm.writePump(id, wrapper)
+
+	if p != nil {
+		p.register(id)
 	}
 
 	log.Printf("Added connection for user %s", id)
 }
 
-func (cm *ConnectionManager) Remove(id string) {
+// Remove forgets the connection, unless the user reconnected meanwhile and it was replaced by a new one
+func (cm *ConnectionManager) Remove(id string, conn *websocket.Conn) {
 	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
-	delete(cm.connections, id)
+	wrapper, exists := cm.connections[id]
+	removed := exists && wrapper.conn == conn
+	if removed {
+		delete(cm.connections, id)
+	}
+	p := cm.presence
+	cm.mutex.Unlock()
+
+	if !removed {
+		return
+	}
+
+	wrapper.close()
+
+	if p != nil {
+		p.unregister(id)
+	}
 }
 
 func (cm *ConnectionManager) Get(id string) (*websocket.Conn, bool) {
@@ -75,17 +106,175 @@ func (cm *ConnectionManager) Get(id string) (*websocket.Conn, bool) {
 	return wrapper.conn, true
 }
 
+// SendMessage queues the message for the user's connection. A client whose queue is full is disconnected
+// rather than holding up the caller, it gets the numbered messages back from the mailbox when it reconnects.
 func (cm *ConnectionManager) SendMessage(id string, message contracts.WSMessage) error {
+	err := cm.queue(id, message)
+	if !errors.Is(err, ErrSendQueueFull) {
+		return err
+	}
+
+	log.Printf("User %s doesn't keep up with its messages, disconnecting it", id)
+
 	cm.mutex.RLock()
 	wrapper, exists := cm.connections[id]
 	cm.mutex.RUnlock()
 
+	if exists {
+		wrapper.conn.Close()
+	}
+
+	return err
+}
+
+// queue adds the message to the send queue of the user's connection, without waiting for room
+func (cm *ConnectionManager) queue(id string, message contracts.WSMessage) error {
+	// Held while queuing, so a removed connection gets no message after its queue was drained
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	wrapper, exists := cm.connections[id]
 	if !exists {
 		return ErrConnectionNotFound
 	}
 
-	wrapper.mutex.Lock()
-	defer wrapper.mutex.Unlock()
+	select {
+	case wrapper.send <- message:
+		return nil
+	default:
+		return ErrSendQueueFull
+	}
+}
+
+// userIDs lists the users connected to this instance
+func (cm *ConnectionManager) userIDs() []string {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	ids := make([]string, 0, len(cm.connections))
+	for id := range cm.connections {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// UseMailbox numbers the messages of Deliver and keeps the ones that can't be delivered, for Replay
+func (cm *ConnectionManager) UseMailbox(store MailboxStore) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	cm.mailbox = store
+}
+
+// Deliver sends the message to the user's connection, on this instance or the one holding it. With a mailbox,
+// the message is numbered first and kept there if the user is offline or the connection fails, so it is
+// only lost if the mailbox fails too.
+func (cm *ConnectionManager) Deliver(ctx context.Context, id string, message contracts.WSMessage) error {
+	mailbox := cm.getMailbox()
+	if mailbox == nil {
+		return cm.deliverNow(ctx, id, message)
+	}
+
+	seq, err := mailbox.NextSeq(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to number the message: %w", err)
+	}
+	message.Seq = seq
+
+	err = cm.deliverNow(ctx, id, message)
+	if err == nil {
+		return nil
+	}
+
+	if putErr := mailbox.Put(ctx, id, message); putErr != nil {
+		return fmt.Errorf("failed to keep the undelivered message (%v): %w", err, putErr)
+	}
+
+	if !errors.Is(err, ErrConnectionNotFound) {
+		log.Printf("Failed to send message %d to user %s, kept it for the reconnection: %v", seq, id, err)
+	}
+
+	return nil
+}
+
+// Replay sends the messages kept for the user that it didn't receive, the ones numbered after lastSeq.
+// It is called once the connection was added, so a message delivered meanwhile may come twice: the client
+// ignores the numbers it has seen.
+func (cm *ConnectionManager) Replay(ctx context.Context, id string, lastSeq uint64) error {
+	mailbox := cm.getMailbox()
+	if mailbox == nil {
+		return nil
+	}
+
+	messages, err := mailbox.Since(ctx, id, lastSeq)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		// The messages stay in the mailbox until the next connection acknowledges them, the rest of
+		// a replay that doesn't fit the queue is sent on the next one
+		if err := cm.queue(id, message); err != nil {
+			return err
+		}
+	}
 
-	return wrapper.conn.WriteJSON(message)
+	if len(messages) > 0 {
+		log.Printf("Replayed %d messages to user %s", len(messages), id)
+	}
+
+	return nil
+}
+
+func (cm *ConnectionManager) getMailbox() MailboxStore {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	return cm.mailbox
+}
+
+// deliverNow sends the message to the user's connection, on this instance or the one holding it
+func (cm *ConnectionManager) deliverNow(ctx context.Context, id string, message contracts.WSMessage) error {
+	err := cm.SendMessage(id, message)
+	if !errors.Is(err, ErrConnectionNotFound) {
+		return err
+	}
+
+	cm.mutex.RLock()
+	p := cm.presence
+	cm.mutex.RUnlock()
+
+	if p == nil {
+		return err
+	}
+
+	return p.forward(ctx, id, message)
+}
+
+// handleForwarded delivers a message another instance forwarded. If the user left meanwhile, a numbered
+// message is kept in the mailbox and the others are dropped.
+func (cm *ConnectionManager) handleForwarded(d amqp.Delivery) {
+	defer d.Ack(false)
+
+	var forwarded forwardedMessage
+	if err := json.Unmarshal(d.Body, &forwarded); err != nil {
+		log.Printf("Failed to unmarshal forwarded message: %v", err)
+		return
+	}
+
+	err := cm.SendMessage(forwarded.UserID, forwarded.Message)
+	if err == nil {
+		return
+	}
+
+	mailbox := cm.getMailbox()
+	if forwarded.Message.Seq == 0 || mailbox == nil {
+		log.Printf("Failed to send forwarded message to user %s: %v", forwarded.UserID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+
+	if err := mailbox.Put(ctx, forwarded.UserID, forwarded.Message); err != nil {
+		log.Printf("Failed to keep forwarded message %d for user %s: %v", forwarded.Message.Seq, forwarded.UserID, err)
+	}
 }
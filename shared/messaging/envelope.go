@@ -0,0 +1,216 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"ride-sharing/shared/contracts"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	ErrUnregisteredSchema       = errors.New("payload type is not registered for the routing key")
+	ErrUnsupportedSchemaVersion = errors.New("no handler for the schema version")
+)
+
+// Producer names the service in the envelopes it publishes. Services set it on startup.
+var Producer = filepath.Base(os.Args[0])
+
+type schemaKey struct {
+	routingKey string
+	version    int
+}
+
+var (
+	schemas        = make(map[schemaKey]reflect.Type)
+	schemaVersions = make(map[string]map[reflect.Type]int) // routing key -> payload type -> version
+)
+
+// RegisterSchema declares T as the payload of the routing key at the given schema version.
+// Every version has its own type: producers choose the version they publish by the type they send,
+// and consumers can handle an old and a new version side by side during a rollout.
+func RegisterSchema[T any](routingKey string, version int) {
+	t := reflect.TypeFor[T]()
+
+	if _, exists := schemas[schemaKey{routingKey, version}]; exists {
+		panic(fmt.Sprintf("schema version %d of %s is registered twice", version, routingKey))
+	}
+	if _, exists := schemaVersions[routingKey][t]; exists {
+		panic(fmt.Sprintf("%v is registered for two versions of %s", t, routingKey))
+	}
+
+	schemas[schemaKey{routingKey, version}] = t
+	if schemaVersions[routingKey] == nil {
+		schemaVersions[routingKey] = make(map[reflect.Type]int)
+	}
+	schemaVersions[routingKey][t] = version
+}
+
+func schemaVersion[T any](routingKey string) (int, error) {
+	t := reflect.TypeFor[T]()
+
+	version, ok := schemaVersions[routingKey][t]
+	if !ok {
+		return 0, fmt.Errorf("%w: %v for %s", ErrUnregisteredSchema, t, routingKey)
+	}
+
+	return version, nil
+}
+
+type envelopeKey struct{}
+
+// withEnvelope remembers the message being handled, so the messages published meanwhile are linked to it
+func withEnvelope(ctx context.Context, msg *contracts.AmqpMessage) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, msg)
+}
+
+// NewEnvelope wraps the payload after checking that T is a registered schema of the routing key.
+// A message created while handling another one is correlated with it.
+func NewEnvelope[T any](ctx context.Context, routingKey, ownerID string, payload T) (contracts.AmqpMessage, error) {
+	return newEnvelope(ctx, uuid.NewString(), routingKey, ownerID, payload)
+}
+
+func newEnvelope[T any](ctx context.Context, eventID, routingKey, ownerID string, payload T) (contracts.AmqpMessage, error) {
+	version, err := schemaVersion[T](routingKey)
+	if err != nil {
+		return contracts.AmqpMessage{}, err
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return contracts.AmqpMessage{}, fmt.Errorf("failed to marshal the %s payload: %w", routingKey, err)
+	}
+
+	msg := contracts.AmqpMessage{
+		EventID:       eventID,
+		EventType:     routingKey,
+		SchemaVersion: version,
+		OccurredAt:    time.Now().UTC(),
+		Producer:      Producer,
+		OwnerID:       ownerID,
+		Data:          data,
+	}
+
+	if cause, ok := ctx.Value(envelopeKey{}).(*contracts.AmqpMessage); ok {
+		msg.CausationID = cause.EventID
+		msg.CorrelationID = cause.CorrelationID
+	}
+	if msg.CorrelationID == "" {
+		msg.CorrelationID = msg.EventID
+	}
+
+	return msg, nil
+}
+
+// Publish wraps the payload in an envelope and publishes it, see NewEnvelope
+func Publish[T any](ctx context.Context, r *RabbitMQ, routingKey, ownerID string, payload T) error {
+	msg, err := NewEnvelope(ctx, routingKey, ownerID, payload)
+	if err != nil {
+		return err
+	}
+
+	return r.PublishMessage(ctx, routingKey, msg)
+}
+
+// PublishWithID publishes the payload under an event ID derived from its source, so the consumers skip
+// the copies published when the source sends it again (ex: a webhook retried by its sender)
+func PublishWithID[T any](ctx context.Context, r *RabbitMQ, eventID, routingKey, ownerID string, payload T) error {
+	msg, err := newEnvelope(ctx, eventID, routingKey, ownerID, payload)
+	if err != nil {
+		return err
+	}
+
+	return r.PublishMessage(ctx, routingKey, msg)
+}
+
+// Event is a consumed message with its decoded payload
+type Event[T any] struct {
+	contracts.AmqpMessage
+	Payload T
+}
+
+type eventHandler func(ctx context.Context, msg *contracts.AmqpMessage) error
+
+// Router dispatches the messages of a queue to the handler of their routing key and schema version
+type Router struct {
+	handlers map[schemaKey]eventHandler
+	keys     map[string]bool
+	inbox    InboxStore
+}
+
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[schemaKey]eventHandler),
+		keys:     make(map[string]bool),
+	}
+}
+
+// UseInbox skips the redelivered copies of the messages the queue's consumer processed already, see Deduplicate
+func (router *Router) UseInbox(store InboxStore) {
+	router.inbox = store
+}
+
+// On handles the messages of the routing key whose payload is T. The schema version is the one T is
+// registered for, so registering a handler per payload type handles several versions.
+func On[T any](router *Router, routingKey string, handler func(ctx context.Context, event *Event[T]) error) {
+	version, err := schemaVersion[T](routingKey)
+	if err != nil {
+		panic(err)
+	}
+
+	router.keys[routingKey] = true
+	router.handlers[schemaKey{routingKey, version}] = func(ctx context.Context, msg *contracts.AmqpMessage) error {
+		var payload T
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			return fmt.Errorf("invalid %s v%d payload: %w", routingKey, version, err)
+		}
+
+		return handler(ctx, &Event[T]{AmqpMessage: *msg, Payload: payload})
+	}
+}
+
+// ConsumeEvents decodes the envelopes of the queue and hands them to the router. A message of a schema
+// version no handler knows fails, so it ends up in the dead letter queue and can be replayed once
+// the consumers are upgraded. Routing keys the router doesn't handle are skipped.
+func (r *RabbitMQ) ConsumeEvents(queueName string, router *Router) error {
+	var consume MessageHandler = func(ctx context.Context, d amqp.Delivery) error {
+		var msg contracts.AmqpMessage
+		if err := json.Unmarshal(d.Body, &msg); err != nil {
+			return fmt.Errorf("failed to unmarshal the envelope: %w", err)
+		}
+
+		// Messages published before the envelope was versioned only have an owner and data
+		if msg.SchemaVersion == 0 {
+			msg.SchemaVersion = 1
+		}
+		if msg.EventType == "" {
+			msg.EventType = d.RoutingKey
+		}
+
+		if !router.keys[d.RoutingKey] {
+			log.Printf("No handler for %s on queue %s, skipping it", d.RoutingKey, queueName)
+			return nil
+		}
+
+		handler, ok := router.handlers[schemaKey{d.RoutingKey, msg.SchemaVersion}]
+		if !ok {
+			return fmt.Errorf("%w: %s v%d", ErrUnsupportedSchemaVersion, d.RoutingKey, msg.SchemaVersion)
+		}
+
+		return handler(withEnvelope(ctx, &msg), &msg)
+	}
+
+	if router.inbox != nil {
+		consume = Deduplicate(router.inbox, queueName, consume)
+	}
+
+	return r.ConsumeMessages(queueName, consume)
+}
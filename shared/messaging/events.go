@@ -3,6 +3,7 @@ package messaging
 import (
 	pbd "ride-sharing/shared/proto/driver"
 	pb "ride-sharing/shared/proto/trip"
+	"ride-sharing/shared/types"
 )
 
 const (
@@ -10,15 +11,47 @@ const (
 	DriverCmdTripRequestQueue        = "driver_cmd_trip_request"
 	DriverTripResponseQueue          = "driver_trip_response"
 	NotifyDriverNoDriversFoundQueue  = "notify_driver_no_drivers_found"
+	TripNoDriversFoundQueue          = "trip_no_drivers_found"
 	NotifyDriverAssignQueue          = "notify_driver_assign"
 	PaymentTripResponseQueue         = "payment_trip_response"
 	NotifyPaymentSessionCreatedQueue = "notify_payment_session_created"
 	NotifyPaymentSuccessQueue        = "payment_success"
+	NotifyTripCancelledQueue         = "notify_trip_cancelled"
+	DriverTripUpdatesQueue           = "driver_trip_updates"
+	DriverTripProgressQueue          = "driver_trip_progress"
+	NotifyTripProgressQueue          = "notify_trip_progress"
+	DriverLocationQueue              = "driver_location"
+	NotifyDriverLocationQueue        = "notify_driver_location"
 	DeadLetterQueue                  = "dead_letter_queue"
 )
 
 type TripEventData struct {
-	Trip *pb.Trip `json:"trip"`
+	Trip     *pb.Trip `json:"trip"`
+	DriverID string   `json:"driverID,omitempty"` // the driver the event is about, if any
+}
+
+type TripCancelData struct {
+	TripID string `json:"tripID"`
+	Reason string `json:"reason"`
+}
+
+// DriverStatusData is sent by a driver going on a break ("offline") or coming back ("online")
+type DriverStatusData struct {
+	Status string `json:"status"`
+}
+
+// DriverTripProgressData is sent by the driver on pickup, start and drop-off.
+// Distance and duration are only set on completion and hold what was actually driven,
+// the trip service caps them to the quoted route.
+type DriverTripProgressData struct {
+	TripID   string  `json:"tripID"`
+	Distance float64 `json:"distance,omitempty"` // meters
+	Duration float64 `json:"duration,omitempty"` // seconds
+}
+
+// DriverLocationData is a position reported by the driver app
+type DriverLocationData struct {
+	Location *types.Coordinate `json:"location"`
 }
 
 type DriverTripResponseData struct {
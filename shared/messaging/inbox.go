@@ -0,0 +1,151 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// InboxLease is how long a consumer holds a message it is processing. Once it ends the message can be
+// processed again, in case the consumer died halfway. It is shorter than the retry delays added up,
+// so a copy that arrived meanwhile is processed by one of its retries.
+const InboxLease = 30 * time.Second
+
+var (
+	ErrMessageProcessed  = errors.New("message was already processed")
+	ErrMessageInProgress = errors.New("message is being processed by another delivery")
+)
+
+// InboxStore records the messages each consumer processed. The consumer is the queue name, so the replicas
+// of a service share their records when the store is shared.
+type InboxStore interface {
+	// Claim locks the message for the consumer for the lease. It returns ErrMessageProcessed if the message
+	// was processed already and ErrMessageInProgress if another delivery holds the lock.
+	Claim(ctx context.Context, consumer, messageID string, lease time.Duration) error
+	// MarkProcessed keeps the message ID for the store's retention, so its copies are skipped
+	MarkProcessed(ctx context.Context, consumer, messageID string) error
+	// Release forgets a claimed message that failed, so its retry is processed
+	Release(ctx context.Context, consumer, messageID string) error
+}
+
+// Deduplicate skips the messages the consumer processed already. Messages are identified by the MessageId
+// their publisher stamped, messages without one are always handled.
+func Deduplicate(store InboxStore, consumer string, handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		if d.MessageId == "" {
+			return handler(ctx, d)
+		}
+
+		err := store.Claim(ctx, consumer, d.MessageId, InboxLease)
+		if errors.Is(err, ErrMessageProcessed) {
+			log.Printf("Message %s was already processed by %s, skipping it", d.MessageId, consumer)
+			return nil
+		}
+		if err != nil {
+			// A message in progress is retried later: the other delivery may still fail
+			return fmt.Errorf("failed to claim message %s: %w", d.MessageId, err)
+		}
+
+		if err := handler(ctx, d); err != nil {
+			if releaseErr := store.Release(ctx, consumer, d.MessageId); releaseErr != nil {
+				log.Printf("Failed to release message %s in the inbox of %s: %v", d.MessageId, consumer, releaseErr)
+			}
+			return err
+		}
+
+		// The message is acked anyway: it was handled, only a copy delivered after the lease is handled again
+		if err := store.MarkProcessed(ctx, consumer, d.MessageId); err != nil {
+			log.Printf("Failed to record message %s in the inbox of %s: %v", d.MessageId, consumer, err)
+		}
+
+		return nil
+	}
+}
+
+type inboxEntry struct {
+	processed bool
+	expiresAt time.Time
+}
+
+// MemoryInboxStore keeps the processed message IDs of this process. Copies delivered to another replica
+// are not detected, use a MongoInboxStore when the consumer is scaled out.
+type MemoryInboxStore struct {
+	retention time.Duration
+	entries   map[string]*inboxEntry
+	lastSweep time.Time
+	now       func() time.Time // the tests move the clock forward instead of waiting
+	mu        sync.Mutex
+}
+
+func NewMemoryInboxStore(retention time.Duration) *MemoryInboxStore {
+	return &MemoryInboxStore{
+		retention: retention,
+		entries:   make(map[string]*inboxEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func inboxKey(consumer, messageID string) string {
+	return consumer + "/" + messageID
+}
+
+func (s *MemoryInboxStore) Claim(ctx context.Context, consumer, messageID string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	key := inboxKey(consumer, messageID)
+	if entry, ok := s.entries[key]; ok && entry.expiresAt.After(now) {
+		if entry.processed {
+			return ErrMessageProcessed
+		}
+		return ErrMessageInProgress
+	}
+
+	s.entries[key] = &inboxEntry{expiresAt: now.Add(lease)}
+	return nil
+}
+
+func (s *MemoryInboxStore) MarkProcessed(ctx context.Context, consumer, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[inboxKey(consumer, messageID)] = &inboxEntry{
+		processed: true,
+		expiresAt: s.now().Add(s.retention),
+	}
+	return nil
+}
+
+func (s *MemoryInboxStore) Release(ctx context.Context, consumer, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := inboxKey(consumer, messageID)
+	if entry, ok := s.entries[key]; ok && !entry.processed {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// sweep drops the expired entries, at most once a minute
+func (s *MemoryInboxStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if !entry.expiresAt.After(now) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ride-sharing/shared/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type inboxDocument struct {
+	ID          string     `bson:"_id"`
+	Consumer    string     `bson:"consumer"`
+	MessageID   string     `bson:"messageId"`
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty"`
+	ProcessedAt *time.Time `bson:"processedAt,omitempty"`
+	ExpiresAt   time.Time  `bson:"expiresAt"`
+}
+
+// MongoInboxStore shares the processed message IDs between the replicas of a consumer
+type MongoInboxStore struct {
+	collection *mongo.Collection
+	retention  time.Duration
+}
+
+func NewMongoInboxStore(database *mongo.Database, retention time.Duration) *MongoInboxStore {
+	return &MongoInboxStore{
+		collection: database.Collection(db.InboxCollection),
+		retention:  retention,
+	}
+}
+
+// EnsureIndexes creates the TTL index removing the records once they expire
+func (s *MongoInboxStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoInboxStore) Claim(ctx context.Context, consumer, messageID string, lease time.Duration) error {
+	now := time.Now()
+	id := inboxKey(consumer, messageID)
+
+	// The upsert inserts the record, or takes over an expired lock. Any other record makes it
+	// collide with the existing _id.
+	filter := bson.M{
+		"_id":         id,
+		"processedAt": bson.M{"$exists": false},
+		"lockedUntil": bson.M{"$lte": now},
+	}
+
+	update := bson.M{"$set": bson.M{
+		"consumer":    consumer,
+		"messageId":   messageID,
+		"lockedUntil": now.Add(lease),
+		"expiresAt":   now.Add(lease),
+	}}
+
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	var doc inboxDocument
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Released meanwhile, the retry of the message claims it
+			return ErrMessageInProgress
+		}
+		return err
+	}
+
+	if doc.ProcessedAt != nil {
+		return ErrMessageProcessed
+	}
+	return ErrMessageInProgress
+}
+
+func (s *MongoInboxStore) MarkProcessed(ctx context.Context, consumer, messageID string) error {
+	now := time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"consumer":    consumer,
+			"messageId":   messageID,
+			"processedAt": now,
+			"expiresAt":   now.Add(s.retention),
+		},
+		"$unset": bson.M{"lockedUntil": ""},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": inboxKey(consumer, messageID)}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoInboxStore) Release(ctx context.Context, consumer, messageID string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{
+		"_id":         inboxKey(consumer, messageID),
+		"processedAt": bson.M{"$exists": false},
+	})
+	return err
+}
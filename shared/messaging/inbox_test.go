@@ -0,0 +1,155 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMemoryInboxStore(t *testing.T) {
+	const (
+		lease     = time.Minute
+		retention = time.Hour
+	)
+
+	type step struct {
+		op       string // claim, process, release or advance
+		consumer string
+		advance  time.Duration // how far the clock moves forward
+		wantErr  error
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "processed message is skipped",
+			steps: []step{
+				{op: "claim", consumer: "a"},
+				{op: "process", consumer: "a"},
+				{op: "claim", consumer: "a", wantErr: ErrMessageProcessed},
+			},
+		},
+		{
+			name: "claimed message is in progress",
+			steps: []step{
+				{op: "claim", consumer: "a"},
+				{op: "claim", consumer: "a", wantErr: ErrMessageInProgress},
+			},
+		},
+		{
+			name: "released message is claimed again",
+			steps: []step{
+				{op: "claim", consumer: "a"},
+				{op: "release", consumer: "a"},
+				{op: "claim", consumer: "a"},
+			},
+		},
+		{
+			name: "release keeps a processed message",
+			steps: []step{
+				{op: "claim", consumer: "a"},
+				{op: "process", consumer: "a"},
+				{op: "release", consumer: "a"},
+				{op: "claim", consumer: "a", wantErr: ErrMessageProcessed},
+			},
+		},
+		{
+			name: "claim is taken over after the lease",
+			steps: []step{
+				{op: "claim", consumer: "a"},
+				{op: "advance", advance: lease - time.Second},
+				{op: "claim", consumer: "a", wantErr: ErrMessageInProgress},
+				{op: "advance", advance: time.Second},
+				{op: "claim", consumer: "a"},
+			},
+		},
+		{
+			name: "processed message is forgotten after the retention",
+			steps: []step{
+				{op: "claim", consumer: "a"},
+				{op: "process", consumer: "a"},
+				{op: "advance", advance: retention - time.Second},
+				{op: "claim", consumer: "a", wantErr: ErrMessageProcessed},
+				{op: "advance", advance: time.Second},
+				{op: "claim", consumer: "a"},
+			},
+		},
+		{
+			name: "consumers are independent",
+			steps: []step{
+				{op: "claim", consumer: "a"},
+				{op: "process", consumer: "a"},
+				{op: "claim", consumer: "b"},
+				{op: "release", consumer: "b"},
+				{op: "claim", consumer: "a", wantErr: ErrMessageProcessed},
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+			store := NewMemoryInboxStore(retention)
+			store.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				var err error
+				switch s.op {
+				case "claim":
+					err = store.Claim(ctx, s.consumer, "message-1", lease)
+				case "process":
+					err = store.MarkProcessed(ctx, s.consumer, "message-1")
+				case "release":
+					err = store.Release(ctx, s.consumer, "message-1")
+				case "advance":
+					now = now.Add(s.advance)
+				}
+
+				if !errors.Is(err, s.wantErr) {
+					t.Fatalf("step %d (%s %s) = %v, want %v", i, s.op, s.consumer, err, s.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	errHandler := errors.New("handler failed")
+
+	tests := []struct {
+		name      string
+		messageID string
+		results   []error // what the handler returns on each delivery
+		wantCalls int
+	}{
+		{"redelivered message is handled once", "message-1", []error{nil, nil, nil}, 1},
+		{"failed message is handled again", "message-1", []error{errHandler, nil, nil}, 2},
+		{"message without ID is always handled", "", []error{nil, nil, nil}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := Deduplicate(NewMemoryInboxStore(time.Minute), "queue", func(ctx context.Context, d amqp.Delivery) error {
+				err := tt.results[calls]
+				calls++
+				return err
+			})
+
+			for range tt.results {
+				_ = handler(context.Background(), amqp.Delivery{MessageId: tt.messageID})
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("handler was called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package messaging
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"ride-sharing/shared/contracts"
+)
+
+// MailboxConfig bounds the messages kept for each offline user
+type MailboxConfig struct {
+	MaxMessages int           // the oldest messages are dropped beyond it
+	TTL         time.Duration // how long a message waits for its user to reconnect
+}
+
+func DefaultMailboxConfig() *MailboxConfig {
+	return &MailboxConfig{
+		MaxMessages: 100,
+		TTL:         15 * time.Minute,
+	}
+}
+
+// MailboxStore numbers the messages sent to each user and keeps the ones that couldn't be delivered
+// until the user reconnects
+type MailboxStore interface {
+	// NextSeq returns the sequence number of the next message to the user. Numbers only increase,
+	// they are not contiguous.
+	NextSeq(ctx context.Context, userID string) (uint64, error)
+	// Put keeps the message for the user
+	Put(ctx context.Context, userID string, message contracts.WSMessage) error
+	// Since returns the kept messages after lastSeq, oldest first, and drops the ones up to lastSeq
+	// since the client received them
+	Since(ctx context.Context, userID string, lastSeq uint64) ([]contracts.WSMessage, error)
+}
+
+type mailboxEntry struct {
+	message   contracts.WSMessage
+	expiresAt time.Time
+}
+
+type memoryMailbox struct {
+	lastSeq uint64
+	entries []mailboxEntry // by sequence number
+}
+
+// MemoryMailboxStore keeps the messages in this process. Only one gateway instance can use it,
+// the others would neither see the messages nor number them in order.
+type MemoryMailboxStore struct {
+	cfg       *MailboxConfig
+	mailboxes map[string]*memoryMailbox
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewMemoryMailboxStore(cfg *MailboxConfig) *MemoryMailboxStore {
+	return &MemoryMailboxStore{
+		cfg:       cfg,
+		mailboxes: make(map[string]*memoryMailbox),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryMailboxStore) mailbox(userID string) *memoryMailbox {
+	mb, ok := s.mailboxes[userID]
+	if !ok {
+		mb = &memoryMailbox{}
+		s.mailboxes[userID] = mb
+	}
+	return mb
+}
+
+func (s *MemoryMailboxStore) NextSeq(ctx context.Context, userID string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+
+	mb := s.mailbox(userID)
+
+	// Numbering from the clock keeps the numbers increasing after a restart, when the counters are lost
+	mb.lastSeq = max(mb.lastSeq+1, uint64(time.Now().UnixMicro()))
+
+	return mb.lastSeq, nil
+}
+
+func (s *MemoryMailboxStore) Put(ctx context.Context, userID string, message contracts.WSMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mb := s.mailbox(userID)
+	mb.entries = append(mb.entries, mailboxEntry{
+		message:   message,
+		expiresAt: time.Now().Add(s.cfg.TTL),
+	})
+
+	// A forwarded message can arrive after a newer one
+	sort.SliceStable(mb.entries, func(i, j int) bool {
+		return mb.entries[i].message.Seq < mb.entries[j].message.Seq
+	})
+
+	if len(mb.entries) > s.cfg.MaxMessages {
+		mb.entries = mb.entries[len(mb.entries)-s.cfg.MaxMessages:]
+	}
+
+	return nil
+}
+
+func (s *MemoryMailboxStore) Since(ctx context.Context, userID string, lastSeq uint64) ([]contracts.WSMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mb, ok := s.mailboxes[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	now := time.Now()
+
+	var (
+		kept     []mailboxEntry
+		messages []contracts.WSMessage
+	)
+	for _, entry := range mb.entries {
+		if entry.message.Seq <= lastSeq || !entry.expiresAt.After(now) {
+			continue
+		}
+		kept = append(kept, entry)
+		messages = append(messages, entry.message)
+	}
+
+	mb.entries = kept
+
+	return messages, nil
+}
+
+// sweep drops the expired messages and the empty mailboxes, at most once a minute. A dropped mailbox
+// loses its counter, numbering from the clock keeps the next numbers higher.
+func (s *MemoryMailboxStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for userID, mb := range s.mailboxes {
+		kept := mb.entries[:0]
+		for _, entry := range mb.entries {
+			if entry.expiresAt.After(now) {
+				kept = append(kept, entry)
+			}
+		}
+		mb.entries = kept
+
+		if len(mb.entries) == 0 {
+			delete(s.mailboxes, userID)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"ride-sharing/shared/contracts"
+	"ride-sharing/shared/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mailboxDocument struct {
+	UserID    string    `bson:"userId"`
+	Seq       uint64    `bson:"seq"`
+	Type      string    `bson:"type"`
+	Data      []byte    `bson:"data"` // JSON, so the payload is sent back as it was received
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// MongoMailboxStore shares the mailboxes and their numbering between the gateway instances
+type MongoMailboxStore struct {
+	messages *mongo.Collection
+	counters *mongo.Collection
+	cfg      *MailboxConfig
+}
+
+func NewMongoMailboxStore(database *mongo.Database, cfg *MailboxConfig) *MongoMailboxStore {
+	return &MongoMailboxStore{
+		messages: database.Collection(db.MailboxCollection),
+		counters: database.Collection(db.MailboxSeqCollection),
+		cfg:      cfg,
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on. Creating an existing index is a no-op.
+func (s *MongoMailboxStore) EnsureIndexes(ctx context.Context) error {
+	if _, err := s.messages.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "seq", Value: 1}},
+	}); err != nil {
+		return err
+	}
+
+	// Messages and counters go away once they expire, a counter is recreated from the clock, see NextSeq
+	for _, collection := range []*mongo.Collection{s.messages, s.counters} {
+		if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MongoMailboxStore) NextSeq(ctx context.Context, userID string) (uint64, error) {
+	now := time.Now()
+
+	// Numbering from the clock keeps the numbers increasing once an expired counter is recreated
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"seq":       bson.M{"$max": bson.A{bson.M{"$add": bson.A{"$seq", 1}}, now.UnixMicro()}},
+		"expiresAt": now.Add(s.cfg.TTL),
+	}}}}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	if err := s.counters.FindOneAndUpdate(ctx, bson.M{"_id": userID}, update, opts).Decode(&counter); err != nil {
+		return 0, err
+	}
+
+	return uint64(counter.Seq), nil
+}
+
+func (s *MongoMailboxStore) Put(ctx context.Context, userID string, message contracts.WSMessage) error {
+	data, err := json.Marshal(message.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %v", err)
+	}
+
+	if _, err := s.messages.InsertOne(ctx, mailboxDocument{
+		UserID:    userID,
+		Seq:       message.Seq,
+		Type:      message.Type,
+		Data:      data,
+		ExpiresAt: time.Now().Add(s.cfg.TTL),
+	}); err != nil {
+		return err
+	}
+
+	// Drop the messages older than the newest MaxMessages
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "seq", Value: -1}}).
+		SetSkip(int64(s.cfg.MaxMessages)).
+		SetProjection(bson.M{"seq": 1})
+
+	var oldest mailboxDocument
+	if err := s.messages.FindOne(ctx, bson.M{"userId": userID}, opts).Decode(&oldest); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = s.messages.DeleteMany(ctx, bson.M{"userId": userID, "seq": bson.M{"$lte": oldest.Seq}})
+	return err
+}
+
+func (s *MongoMailboxStore) Since(ctx context.Context, userID string, lastSeq uint64) ([]contracts.WSMessage, error) {
+	if _, err := s.messages.DeleteMany(ctx, bson.M{"userId": userID, "seq": bson.M{"$lte": lastSeq}}); err != nil {
+		return nil, err
+	}
+
+	// The TTL monitor runs every minute, expired documents can still be around
+	filter := bson.M{"userId": userID, "expiresAt": bson.M{"$gt": time.Now()}}
+
+	cursor, err := s.messages.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []mailboxDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	messages := make([]contracts.WSMessage, 0, len(docs))
+	for _, doc := range docs {
+		messages = append(messages, contracts.WSMessage{
+			Type: doc.Type,
+			Data: json.RawMessage(doc.Data),
+			Seq:  doc.Seq,
+		})
+	}
+
+	return messages, nil
+}
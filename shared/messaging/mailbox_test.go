@@ -0,0 +1,126 @@
+package messaging
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"ride-sharing/shared/contracts"
+)
+
+func TestMemoryMailboxStoreSince(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxMessages int
+		ttl         time.Duration
+		put         []uint64 // sequence numbers of the messages kept, in order
+		wait        time.Duration
+		lastSeq     uint64
+		want        []uint64
+		wantLeft    []uint64 // what a second Since(0) returns
+	}{
+		{
+			name: "every message", maxMessages: 10, ttl: time.Minute,
+			put: []uint64{1, 2, 3}, lastSeq: 0,
+			want: []uint64{1, 2, 3}, wantLeft: []uint64{1, 2, 3},
+		},
+		{
+			name: "messages after lastSeq, the others are dropped", maxMessages: 10, ttl: time.Minute,
+			put: []uint64{1, 2, 3}, lastSeq: 2,
+			want: []uint64{3}, wantLeft: []uint64{3},
+		},
+		{
+			name: "lastSeq after every message", maxMessages: 10, ttl: time.Minute,
+			put: []uint64{1, 2, 3}, lastSeq: 5,
+			want: nil, wantLeft: nil,
+		},
+		{
+			name: "out of order messages come sorted", maxMessages: 10, ttl: time.Minute,
+			put: []uint64{3, 1, 2}, lastSeq: 0,
+			want: []uint64{1, 2, 3}, wantLeft: []uint64{1, 2, 3},
+		},
+		{
+			name: "oldest messages dropped beyond the maximum", maxMessages: 2, ttl: time.Minute,
+			put: []uint64{1, 2, 3}, lastSeq: 0,
+			want: []uint64{2, 3}, wantLeft: []uint64{2, 3},
+		},
+		{
+			name: "late message older than the maximum is dropped", maxMessages: 2, ttl: time.Minute,
+			put: []uint64{2, 3, 1}, lastSeq: 0,
+			want: []uint64{2, 3}, wantLeft: []uint64{2, 3},
+		},
+		{
+			name: "expired messages", maxMessages: 10, ttl: 10 * time.Millisecond,
+			put: []uint64{1, 2}, wait: 20 * time.Millisecond, lastSeq: 0,
+			want: nil, wantLeft: nil,
+		},
+		{
+			name: "empty mailbox", maxMessages: 10, ttl: time.Minute,
+			put: nil, lastSeq: 0,
+			want: nil, wantLeft: nil,
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryMailboxStore(&MailboxConfig{MaxMessages: tt.maxMessages, TTL: tt.ttl})
+
+			for _, seq := range tt.put {
+				if err := store.Put(ctx, "user-1", contracts.WSMessage{Type: "test", Seq: seq}); err != nil {
+					t.Fatalf("Put(%d) = %v", seq, err)
+				}
+			}
+			time.Sleep(tt.wait)
+
+			got, err := store.Since(ctx, "user-1", tt.lastSeq)
+			if err != nil {
+				t.Fatalf("Since(%d) = %v", tt.lastSeq, err)
+			}
+			if seqs := sequences(got); !slices.Equal(seqs, tt.want) {
+				t.Errorf("Since(%d) = %v, want %v", tt.lastSeq, seqs, tt.want)
+			}
+
+			left, err := store.Since(ctx, "user-1", 0)
+			if err != nil {
+				t.Fatalf("Since(0) = %v", err)
+			}
+			if seqs := sequences(left); !slices.Equal(seqs, tt.wantLeft) {
+				t.Errorf("then Since(0) = %v, want %v", seqs, tt.wantLeft)
+			}
+
+			// The mailboxes of the users are separate
+			other, _ := store.Since(ctx, "user-2", 0)
+			if len(other) != 0 {
+				t.Errorf("Since(0) of another user = %v, want none", sequences(other))
+			}
+		})
+	}
+}
+
+func TestMemoryMailboxStoreNextSeq(t *testing.T) {
+	store := NewMemoryMailboxStore(DefaultMailboxConfig())
+	ctx := context.Background()
+
+	var last uint64
+	for i := 0; i < 100; i++ {
+		seq, err := store.NextSeq(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("NextSeq() = %v", err)
+		}
+		if seq <= last {
+			t.Fatalf("NextSeq() = %d after %d, want an increasing number", seq, last)
+		}
+		last = seq
+	}
+}
+
+func sequences(messages []contracts.WSMessage) []uint64 {
+	var seqs []uint64
+	for _, m := range messages {
+		seqs = append(seqs, m.Seq)
+	}
+	return seqs
+}
@@ -0,0 +1,197 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ride-sharing/shared/contracts"
+	"ride-sharing/shared/tracing"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// GatewayExchange routes the notifications forwarded between gateway instances, by instance ID
+	GatewayExchange = "gateway"
+
+	// PresenceTTL is how long a user stays registered to an instance that stopped refreshing it,
+	// after a crash for instance
+	PresenceTTL = 60 * time.Second
+
+	presenceTimeout = 5 * time.Second
+)
+
+// PresenceStore records which gateway instance holds the connection of each user
+type PresenceStore interface {
+	// Register records the user as connected to the instance, replacing the instance it was connected to
+	Register(ctx context.Context, userID, instanceID string, ttl time.Duration) error
+	// Unregister forgets the user, unless it reconnected to another instance meanwhile
+	Unregister(ctx context.Context, userID, instanceID string) error
+	// Refresh extends the registrations of the users still connected to the instance. The ones left over
+	// by a previous run of the instance expire.
+	Refresh(ctx context.Context, instanceID string, userIDs []string, ttl time.Duration) error
+	// Lookup returns the instance holding the user's connection, or "" if the user is offline
+	Lookup(ctx context.Context, userID string) (string, error)
+}
+
+// forwardedMessage is a notification sent to the gateway instance holding its user's connection
+type forwardedMessage struct {
+	UserID  string              `json:"userId"`
+	Message contracts.WSMessage `json:"message"`
+}
+
+// presence shares the connections of this instance with the other ones, and delivers the messages
+// they forward to it
+type presence struct {
+	rb         *RabbitMQ
+	connMgr    *ConnectionManager
+	store      PresenceStore
+	instanceID string
+}
+
+// EnablePresence lets several gateway instances run side by side: the users connected to this instance are
+// registered in the store, and Deliver forwards the messages of the users connected elsewhere to their
+// instance through its own queue. The registrations are refreshed until the context is cancelled.
+func (cm *ConnectionManager) EnablePresence(ctx context.Context, rb *RabbitMQ, store PresenceStore, instanceID string) error {
+	p := &presence{
+		rb:         rb,
+		connMgr:    cm,
+		store:      store,
+		instanceID: instanceID,
+	}
+
+	queueName := fmt.Sprintf("%s.%s", GatewayExchange, instanceID)
+
+	if err := rb.subscribe(&consumer{
+		queue:  queueName,
+		handle: cm.handleForwarded,
+		declare: func(ch *amqp.Channel) error {
+			return declareInstanceQueue(ch, queueName, instanceID)
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to consume the instance queue: %w", err)
+	}
+
+	cm.mutex.Lock()
+	cm.presence = p
+	cm.mutex.Unlock()
+
+	for _, id := range cm.userIDs() {
+		p.register(id)
+	}
+
+	go p.refresh(ctx)
+
+	return nil
+}
+
+// declareInstanceQueue declares the queue of the instance. It is exclusive: it goes away with the connection,
+// and is declared again when it reconnects.
+func declareInstanceQueue(ch *amqp.Channel, queueName, instanceID string) error {
+	if err := ch.ExchangeDeclare(
+		GatewayExchange,
+		amqp.ExchangeDirect,
+		true,  // durable
+		false, // auto-deleted
+		false, // internal
+		false, // no-wait
+		nil,   // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %v", GatewayExchange, err)
+	}
+
+	if _, err := ch.QueueDeclare(
+		queueName,
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %v", queueName, err)
+	}
+
+	if err := ch.QueueBind(queueName, instanceID, GatewayExchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue %s: %v", queueName, err)
+	}
+
+	return nil
+}
+
+func (p *presence) register(userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+
+	if err := p.store.Register(ctx, userID, p.instanceID, PresenceTTL); err != nil {
+		log.Printf("Failed to register the presence of user %s: %v", userID, err)
+	}
+}
+
+func (p *presence) unregister(userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+
+	if err := p.store.Unregister(ctx, userID, p.instanceID); err != nil {
+		log.Printf("Failed to unregister the presence of user %s: %v", userID, err)
+	}
+}
+
+// refresh keeps the registrations of the instance alive until the context is cancelled
+func (p *presence) refresh(ctx context.Context) {
+	ticker := time.NewTicker(PresenceTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshCtx, cancel := context.WithTimeout(ctx, presenceTimeout)
+			if err := p.store.Refresh(refreshCtx, p.instanceID, p.connMgr.userIDs(), PresenceTTL); err != nil {
+				log.Printf("Failed to refresh the presence of instance %s: %v", p.instanceID, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// forward sends the message to the instance holding the user's connection. It returns ErrConnectionNotFound
+// if the user is not connected to any instance, or if the queue of the instance is gone, after a crash for
+// instance.
+func (p *presence) forward(ctx context.Context, userID string, message contracts.WSMessage) error {
+	instanceID, err := p.store.Lookup(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to look up the presence of user %s: %w", userID, err)
+	}
+
+	// Registered here but already gone, or not registered anywhere
+	if instanceID == "" || instanceID == p.instanceID {
+		return ErrConnectionNotFound
+	}
+
+	body, err := json.Marshal(forwardedMessage{UserID: userID, Message: message})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %v", err)
+	}
+
+	msg := amqp.Publishing{
+		ContentType: "application/json",
+		MessageId:   uuid.NewString(),
+		Timestamp:   time.Now(),
+		AppId:       Producer,
+		Body:        body,
+	}
+
+	err = tracing.TracedPublisher(ctx, GatewayExchange, instanceID, msg, p.rb.publishUnlessReturned)
+	if errors.Is(err, ErrMessageReturned) {
+		log.Printf("Instance %s holding user %s is gone: %v", instanceID, userID, err)
+		return ErrConnectionNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,88 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ride-sharing/shared/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type presenceDocument struct {
+	UserID     string    `bson:"_id"`
+	InstanceID string    `bson:"instanceId"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+}
+
+// MongoPresenceStore shares the presence of the users between the gateway instances
+type MongoPresenceStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoPresenceStore(database *mongo.Database) *MongoPresenceStore {
+	return &MongoPresenceStore{
+		collection: database.Collection(db.PresenceCollection),
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on. Creating an existing index is a no-op.
+func (s *MongoPresenceStore) EnsureIndexes(ctx context.Context) error {
+	// The users of an instance that stopped refreshing them are removed once they expire
+	if _, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}); err != nil {
+		return err
+	}
+
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "instanceId", Value: 1}},
+	})
+	return err
+}
+
+func (s *MongoPresenceStore) Register(ctx context.Context, userID, instanceID string, ttl time.Duration) error {
+	update := bson.M{"$set": bson.M{
+		"instanceId": instanceID,
+		"expiresAt":  time.Now().Add(ttl),
+	}}
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": userID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoPresenceStore) Unregister(ctx context.Context, userID, instanceID string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": userID, "instanceId": instanceID})
+	return err
+}
+
+func (s *MongoPresenceStore) Refresh(ctx context.Context, instanceID string, userIDs []string, ttl time.Duration) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": userIDs}, "instanceId": instanceID}
+	update := bson.M{"$set": bson.M{"expiresAt": time.Now().Add(ttl)}}
+
+	_, err := s.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (s *MongoPresenceStore) Lookup(ctx context.Context, userID string) (string, error) {
+	// The TTL monitor runs every minute, expired documents can still be around
+	filter := bson.M{"_id": userID, "expiresAt": bson.M{"$gt": time.Now()}}
+
+	var doc presenceDocument
+	if err := s.collection.FindOne(ctx, filter).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return doc.InstanceID, nil
+}
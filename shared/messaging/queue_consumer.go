@@ -1,68 +1,95 @@
 package messaging
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 
 	"ride-sharing/shared/contracts"
+
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// wsMessageTypes renames events whose WebSocket message type differs from their routing key
+var wsMessageTypes = map[string]string{
+	// The web client receives the assigned driver's position as a location update
+	contracts.TripEventDriverLocation: contracts.DriverCmdLocation,
+}
+
+// supersededEvents are replaced by the next one of their kind, so they are dropped rather than retried
+// or kept when they can't be delivered
+var supersededEvents = map[string]bool{
+	contracts.TripEventDriverLocation: true,
+}
+
+// QueueConsumer forwards the messages of the notification queues to the WebSocket of their owner.
+// A process runs a single one, whatever the number of open connections, so every message of a queue
+// is seen by the process and routed with the connection manager.
 type QueueConsumer struct {
-	rb        *RabbitMQ
-	connMgr   *ConnectionManager
-	queueName string
+	rb         *RabbitMQ
+	connMgr    *ConnectionManager
+	queueNames []string
 }
 
-func NewQueueConsumer(rb *RabbitMQ, connMgr *ConnectionManager, queueName string) *QueueConsumer {
+func NewQueueConsumer(rb *RabbitMQ, connMgr *ConnectionManager, queueNames ...string) *QueueConsumer {
 	return &QueueConsumer{
-		rb:        rb,
-		connMgr:   connMgr,
-		queueName: queueName,
+		rb:         rb,
+		connMgr:    connMgr,
+		queueNames: queueNames,
 	}
 }
 
+// Start consumes every queue. A message is acked once it was written to its owner's connection, or kept
+// in the mailbox when the owner is offline. Without a mailbox it is retried from the retry queues and
+// dead-lettered after the last one.
 func (qc *QueueConsumer) Start() error {
-	msgs, err := qc.rb.Channel.Consume(
-		qc.queueName,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+	for _, queueName := range qc.queueNames {
+		if err := qc.rb.ConsumeMessages(queueName, qc.handle); err != nil {
+			return fmt.Errorf("failed to start consumer for queue %s: %w", queueName, err)
+		}
+	}
+
+	return nil
+}
+
+func (qc *QueueConsumer) handle(ctx context.Context, msg amqp.Delivery) error {
+	var msgBody contracts.AmqpMessage
+	if err := json.Unmarshal(msg.Body, &msgBody); err != nil {
+		return fmt.Errorf("failed to unmarshal message: %w", err)
 	}
 
-	go func() {
-		for msg := range msgs {
-			var msgBody contracts.AmqpMessage
-			if err := json.Unmarshal(msg.Body, &msgBody); err != nil {
-				log.Println("Failed to unmarshal message:", err)
-				continue
-			}
-
-			userID := msgBody.OwnerID
-
-			var payload any
-			if msgBody.Data != nil {
-				if err := json.Unmarshal(msgBody.Data, &payload); err != nil {
-					log.Println("Failed to unmarshal payload:", err)
-					continue
-				}
-			}
-
-			clientMsg := contracts.WSMessage{
-				Type: msg.RoutingKey,
-				Data: payload,
-			}
-
-			if err := qc.connMgr.SendMessage(userID, clientMsg); err != nil {
-				log.Printf("Failed to send message to user %s: %v", userID, err)
-			}
+	userID := msgBody.OwnerID
+
+	var payload any
+	if msgBody.Data != nil {
+		if err := json.Unmarshal(msgBody.Data, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal payload: %w", err)
 		}
-	}()
+	}
+
+	msgType := msg.RoutingKey
+	if t, ok := wsMessageTypes[msgType]; ok {
+		msgType = t
+	}
+
+	clientMsg := contracts.WSMessage{
+		Type: msgType,
+		Data: payload,
+	}
+
+	// Superseded events are neither numbered, kept nor retried
+	if supersededEvents[msg.RoutingKey] {
+		if err := qc.connMgr.deliverNow(ctx, userID, clientMsg); err != nil && !errors.Is(err, ErrConnectionNotFound) {
+			log.Printf("Failed to send %s to user %s: %v", msg.RoutingKey, userID, err)
+		}
+		return nil
+	}
+
+	if err := qc.connMgr.Deliver(ctx, userID, clientMsg); err != nil {
+		return fmt.Errorf("failed to send %s to user %s: %w", msg.RoutingKey, userID, err)
+	}
 
 	return nil
 }
@@ -3,11 +3,13 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"ride-sharing/shared/contracts"
-	"ride-sharing/shared/retry"
 	"ride-sharing/shared/tracing"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -15,98 +17,123 @@ import (
 const (
 	TripExchange       = "trip"
 	DeadLetterExchange = "dlx"
+
+	// PublishConfirmTimeout is how long PublishMessage waits for the broker to confirm a message
+	PublishConfirmTimeout = 5 * time.Second
+)
+
+var (
+	ErrMessageNacked = errors.New("message was rejected by the broker")
+	ErrNotConnected  = errors.New("not connected to RabbitMQ")
+	// ErrMessageReturned is returned by publishUnlessReturned for a message no queue is bound for
+	ErrMessageReturned = errors.New("message was returned by the broker")
 )
 
 type RabbitMQ struct {
+	uri     string
 	conn    *amqp.Connection
-	Channel *amqp.Channel
+	channel *amqp.Channel
+	ready   bool
+	closed  bool
+
+	// consumers are started again on every new channel, see supervise
+	consumers         []*consumer
+	readinessHandlers []func(ready bool)
+	returns           returnWatches
+	confirmTrackers   map[*amqp.Channel]*confirmTracker // of the open channels, see trackPublishes
+	mu                sync.RWMutex
 }
 
+// NewRabbitMQ connects to the broker and keeps the connection up: if it drops, the topology is declared
+// again and the registered consumers are restarted once the broker is back.
 func NewRabbitMQ(uri string) (*RabbitMQ, error) {
-	conn, err := amqp.Dial(uri)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
-	}
+	rmq := &RabbitMQ{uri: uri}
 
-	ch, err := conn.Channel()
+	conn, ch, err := rmq.connect()
 	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to create channel: %v", err)
+		return nil, err
 	}
 
-	rmq := &RabbitMQ{
-		conn:    conn,
-		Channel: ch,
-	}
+	rmq.conn = conn
+	rmq.channel = ch
+	rmq.ready = true
 
-	if err := rmq.setupExchangesAndQueues(); err != nil {
-		// Clean up if setup fails
-		rmq.Close()
-		return nil, fmt.Errorf("failed to setup exchanges and queues: %v", err)
-	}
+	go rmq.supervise(conn, ch)
 
 	return rmq, nil
 }
 
-type MessageHandler func(context.Context, amqp.Delivery) error
+// connect dials the broker, opens the channel everything is published and consumed on and declares the topology
+func (r *RabbitMQ) connect() (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(r.uri)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to create channel: %v", err)
+	}
+
+	// The broker acks or nacks every message published on the channel, see publish
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to put the channel in confirm mode: %v", err)
+	}
 
-func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) error {
 	// Set prefetch count to 1 for fair dispatch
 	// This tells RabbitMQ not to give more than one message to a service at a time.
 	// The worker will only get the next message after it has acknowledged the previous one.
-	err := r.Channel.Qos(
+	if err := ch.Qos(
 		1,     // prefetchCount: Limit to 1 unacknowledged message per consumer
 		0,     // prefetchSize: No specific limit on message size
 		false, // global: Apply prefetchCount to each consumer individually
-	)
-	if err != nil {
-		return fmt.Errorf("failed to set QoS: %v", err)
+	); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to set QoS: %v", err)
 	}
 
-	msgs, err := r.Channel.Consume(
-		queueName, // queue
-		"",        // consumer
-		false,     // auto-ack
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
-	)
-	if err != nil {
-		return err
+	// Messages are published as mandatory, the broker returns those that no queue is bound for.
+	// The confirms are followed along, so a publisher can tell if its message was returned.
+	tracker := newConfirmTracker()
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation))
+	r.setConfirmTracker(ch, tracker)
+	go func() {
+		r.trackPublishes(returns, confirms, tracker)
+		r.setConfirmTracker(ch, nil)
+	}()
+
+	if err := setupExchangesAndQueues(ch); err != nil {
+		// Clean up if setup fails
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to setup exchanges and queues: %v", err)
 	}
 
-	go func() {
-		for msg := range msgs {
+	return conn, ch, nil
+}
+
+type MessageHandler func(context.Context, amqp.Delivery) error
+
+// ConsumeMessages acks the messages the handler succeeds with. A failing message is retried later
+// from a retry queue, without holding up the ones behind it, see retryLater.
+func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) error {
+	return r.subscribe(&consumer{
+		queue: queueName,
+		handle: func(msg amqp.Delivery) {
+			restoreRouting(&msg)
+
 			if err := tracing.TracedConsumer(msg, func(ctx context.Context, d amqp.Delivery) error {
 				log.Printf("Received a message: %s", msg.Body)
 
-				cfg := retry.DefaultConfig()
-				err := retry.WithBackoff(ctx, cfg, func() error {
-					return handler(ctx, d)
-				})
-				if err != nil {
-					log.Printf("Message processing failed after %d retries for message ID: %s, err: %v", cfg.MaxRetries, d.MessageId, err)
-
-					// Add failure context before sending to the DLQ
-					headers := amqp.Table{}
-					if d.Headers != nil {
-						headers = d.Headers
-					}
-
-					headers["x-death-reason"] = err.Error()
-					headers["x-origin-exchange"] = d.Exchange
-					headers["x-original-routing-key"] = d.RoutingKey
-					headers["x-retry-count"] = cfg.MaxRetries
-					d.Headers = headers
-
-					// Reject without requeue - message will go to the DLQ
-					_ = d.Reject(false)
+				if err := handler(ctx, d); err != nil {
+					r.retryLater(ctx, queueName, d, err)
 					return err
 				}
 
 				// Only Ack if the handler succeeds
-				if ackErr := msg.Ack(false); ackErr != nil {
+				if ackErr := d.Ack(false); ackErr != nil {
 					log.Printf("ERROR: Failed to Ack message: %v. Message body: %s", ackErr, msg.Body)
 				}
 
@@ -114,12 +141,11 @@ func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) err
 			}); err != nil {
 				log.Printf("Error processing message: %v", err)
 			}
-		}
-	}()
-
-	return nil
+		},
+	})
 }
 
+// PublishMessage publishes an envelope built with NewEnvelope. Use Publish to publish a payload.
 func (r *RabbitMQ) PublishMessage(ctx context.Context, routingKey string, message contracts.AmqpMessage) error {
 	log.Printf("Publishing message with routing key: %s", routingKey)
 
@@ -129,27 +155,115 @@ func (r *RabbitMQ) PublishMessage(ctx context.Context, routingKey string, messag
 	}
 
 	msg := amqp.Publishing{
-		DeliveryMode: amqp.Persistent,
-		ContentType:  "application/json",
-		Body:         jsonMsg,
+		DeliveryMode:  amqp.Persistent,
+		ContentType:   "application/json",
+		MessageId:     message.EventID,
+		CorrelationId: message.CorrelationID,
+		Type:          message.EventType,
+		Timestamp:     message.OccurredAt,
+		AppId:         message.Producer,
+		Body:          jsonMsg,
 	}
 
 	return tracing.TracedPublisher(ctx, TripExchange, routingKey, msg, r.publish)
 }
 
+// publishUnlessReturned publishes the message like publish, but returns ErrMessageReturned if no queue
+// is bound for it. The message needs an ID.
+func (r *RabbitMQ) publishUnlessReturned(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	returned, unwatch := r.returns.watch(msg.MessageId)
+	defer unwatch()
+
+	ch, deliveryTag, err := r.publishConfirmed(ctx, exchange, routingKey, msg)
+	if err != nil {
+		return err
+	}
+
+	return awaitReturn(r.getConfirmTracker(ch), deliveryTag, returned, routingKey)
+}
+
+// awaitReturn returns ErrMessageReturned if the acked message was returned. The ack resolves the publisher's
+// confirmation before it goes through the tracker, which handles the return first if there is one.
+func awaitReturn(tracker *confirmTracker, deliveryTag uint64, returned <-chan struct{}, routingKey string) error {
+	if tracker == nil || !tracker.waitFor(deliveryTag) {
+		return fmt.Errorf("%w: the channel closed before the return of %s was known", ErrNotConnected, routingKey)
+	}
+
+	select {
+	case <-returned:
+		return fmt.Errorf("%w: %s", ErrMessageReturned, routingKey)
+	default:
+		return nil
+	}
+}
+
+// publish waits for the broker to confirm the message. An unroutable message is still acked,
+// after being returned to handleReturn.
 func (r *RabbitMQ) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
-	return r.Channel.PublishWithContext(ctx,
+	_, _, err := r.publishConfirmed(ctx, exchange, routingKey, msg)
+	return err
+}
+
+// publishConfirmed is publish, it returns the channel and the delivery tag the message was published with
+func (r *RabbitMQ) publishConfirmed(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (*amqp.Channel, uint64, error) {
+	// Fail fast while the connection is down, callers retry or report the error
+	ch := r.readyChannel()
+	if ch == nil {
+		return nil, 0, ErrNotConnected
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx,
 		exchange,   // exchange
 		routingKey, // routing key
-		false,      // mandatory
+		true,       // mandatory
 		false,      // immediate
 		msg,
 	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, PublishConfirmTimeout)
+	defer cancel()
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("no confirmation for the message %s: %w", routingKey, err)
+	}
+
+	if !acked {
+		return nil, 0, fmt.Errorf("%w: %s", ErrMessageNacked, routingKey)
+	}
+
+	return ch, confirmation.DeliveryTag, nil
 }
 
-func (r *RabbitMQ) setupDeadLetterExchange() error {
+// setConfirmTracker records the tracker of the channel, or forgets it when nil
+func (r *RabbitMQ) setConfirmTracker(ch *amqp.Channel, tracker *confirmTracker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tracker == nil {
+		delete(r.confirmTrackers, ch)
+		return
+	}
+
+	if r.confirmTrackers == nil {
+		r.confirmTrackers = make(map[*amqp.Channel]*confirmTracker)
+	}
+	r.confirmTrackers[ch] = tracker
+}
+
+func (r *RabbitMQ) getConfirmTracker(ch *amqp.Channel) *confirmTracker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.confirmTrackers[ch]
+}
+
+func setupDeadLetterExchange(ch *amqp.Channel) error {
 	// Declare the dead letter exchange
-	err := r.Channel.ExchangeDeclare(
+	err := ch.ExchangeDeclare(
 		DeadLetterExchange,
 		"topic",
 		true,  // durable
@@ -163,7 +277,7 @@ func (r *RabbitMQ) setupDeadLetterExchange() error {
 	}
 
 	// Declare the dead letter queue
-	q, err := r.Channel.QueueDeclare(
+	q, err := ch.QueueDeclare(
 		DeadLetterQueue,
 		true,  // durable
 		false, // delete when unused
@@ -176,7 +290,7 @@ func (r *RabbitMQ) setupDeadLetterExchange() error {
 	}
 
 	// Bind the queue to the exchange with a wildcard routing key
-	err = r.Channel.QueueBind(
+	err = ch.QueueBind(
 		q.Name,
 		"#", // wildcard routing key to catch all messages
 		DeadLetterExchange,
@@ -190,13 +304,45 @@ func (r *RabbitMQ) setupDeadLetterExchange() error {
 	return nil
 }
 
-func (r *RabbitMQ) setupExchangesAndQueues() error {
+// tripQueueBindings are the queues of the trip exchange and the routing keys bound to each. Messages are
+// published as mandatory: a routing key nothing is bound for is returned by the broker, see handleReturn.
+var tripQueueBindings = []struct {
+	queue       string
+	routingKeys []string
+}{
+	{FindAvailableDriversQueue, []string{contracts.TripEventCreated, contracts.TripEventDriverNotInterested}},
+	{DriverCmdTripRequestQueue, []string{contracts.DriverCmdTripRequest}},
+	{DriverTripResponseQueue, []string{contracts.DriverCmdTripAccept, contracts.DriverCmdTripDecline}},
+	{NotifyDriverNoDriversFoundQueue, []string{contracts.TripEventNoDriversFound}},
+	{TripNoDriversFoundQueue, []string{contracts.TripEventNoDriversFound}},
+	{NotifyDriverAssignQueue, []string{contracts.TripEventDriverAssigned}},
+	{PaymentTripResponseQueue, []string{contracts.PaymentCmdCreateSession}},
+	{NotifyPaymentSessionCreatedQueue, []string{contracts.PaymentEventSessionCreated}},
+	{NotifyPaymentSuccessQueue, []string{contracts.PaymentEventSuccess}},
+	{NotifyTripCancelledQueue, []string{contracts.TripEventCancelled}},
+	{DriverTripUpdatesQueue, []string{
+		contracts.TripEventDriverAssigned, contracts.TripEventStarted, contracts.TripEventCancelled,
+		contracts.TripEventCompleted,
+	}},
+	{DriverTripProgressQueue, []string{
+		contracts.DriverCmdArrived, contracts.DriverCmdTripStart, contracts.DriverCmdTripComplete,
+	}},
+	{DriverLocationQueue, []string{contracts.DriverCmdLocation}},
+	{NotifyDriverLocationQueue, []string{contracts.TripEventDriverLocation}},
+	// The rider follows the trip until it is paid, or expired when no driver took it
+	{NotifyTripProgressQueue, []string{
+		contracts.TripEventDriverArrived, contracts.TripEventStarted, contracts.TripEventCompleted,
+		contracts.TripEventPaid, contracts.TripEventExpired,
+	}},
+}
+
+func setupExchangesAndQueues(ch *amqp.Channel) error {
 	// First setup the DLQ exchange and queue
-	if err := r.setupDeadLetterExchange(); err != nil {
+	if err := setupDeadLetterExchange(ch); err != nil {
 		return err
 	}
 
-	err := r.Channel.ExchangeDeclare(
+	err := ch.ExchangeDeclare(
 		TripExchange, // name
 		"topic",      // type
 		true,         // durable
@@ -209,82 +355,22 @@ func (r *RabbitMQ) setupExchangesAndQueues() error {
 		return fmt.Errorf("failed to declare exchange: %s: %v", TripExchange, err)
 	}
 
-	if err := r.declareAndBindQueue(
-		FindAvailableDriversQueue,
-		[]string{
-			contracts.TripEventCreated, contracts.TripEventDriverNotInterested,
-		},
-		TripExchange,
-	); err != nil {
-		return err
-	}
-
-	if err := r.declareAndBindQueue(
-		DriverCmdTripRequestQueue,
-		[]string{contracts.DriverCmdTripRequest},
-		TripExchange,
-	); err != nil {
-		return err
-	}
-
-	if err := r.declareAndBindQueue(
-		DriverTripResponseQueue,
-		[]string{contracts.DriverCmdTripAccept, contracts.DriverCmdTripDecline},
-		TripExchange,
-	); err != nil {
-		return err
-	}
-
-	if err := r.declareAndBindQueue(
-		NotifyDriverNoDriversFoundQueue,
-		[]string{contracts.TripEventNoDriversFound},
-		TripExchange,
-	); err != nil {
-		return err
-	}
-
-	if err := r.declareAndBindQueue(
-		NotifyDriverAssignQueue,
-		[]string{contracts.TripEventDriverAssigned},
-		TripExchange,
-	); err != nil {
-		return err
-	}
-
-	if err := r.declareAndBindQueue(
-		PaymentTripResponseQueue,
-		[]string{contracts.PaymentCmdCreateSession},
-		TripExchange,
-	); err != nil {
-		return err
-	}
-
-	if err := r.declareAndBindQueue(
-		NotifyPaymentSessionCreatedQueue,
-		[]string{contracts.PaymentEventSessionCreated},
-		TripExchange,
-	); err != nil {
-		return err
-	}
-
-	if err := r.declareAndBindQueue(
-		NotifyPaymentSuccessQueue,
-		[]string{contracts.PaymentEventSuccess},
-		TripExchange,
-	); err != nil {
-		return err
+	for _, binding := range tripQueueBindings {
+		if err := declareAndBindQueue(ch, binding.queue, binding.routingKeys, TripExchange); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (r *RabbitMQ) declareAndBindQueue(queueName string, messageTypes []string, exchange string) error {
+func declareAndBindQueue(ch *amqp.Channel, queueName string, messageTypes []string, exchange string) error {
 	// Add dead letter configuration
 	args := amqp.Table{
 		"x-dead-letter-exchange": DeadLetterExchange,
 	}
 
-	q, err := r.Channel.QueueDeclare(
+	q, err := ch.QueueDeclare(
 		queueName, // name
 		true,      // durable
 		false,     // delete when unused
@@ -293,11 +379,15 @@ func (r *RabbitMQ) declareAndBindQueue(queueName string, messageTypes []string,
 		args,      // arguments with DLX config
 	)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to declare queue %s: %v", queueName, err)
+	}
+
+	if err := declareRetryQueues(ch, q.Name); err != nil {
+		return err
 	}
 
 	for _, msg := range messageTypes {
-		if err := r.Channel.QueueBind(
+		if err := ch.QueueBind(
 			q.Name,   // queue name
 			msg,      // routing key
 			exchange, // exchange
@@ -312,10 +402,17 @@ func (r *RabbitMQ) declareAndBindQueue(queueName string, messageTypes []string,
 }
 
 func (r *RabbitMQ) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Stops the supervisor from reconnecting
+	r.closed = true
+	r.ready = false
+
+	if r.channel != nil {
+		r.channel.Close()
+	}
 	if r.conn != nil {
 		r.conn.Close()
 	}
-	if r.Channel != nil {
-		r.Channel.Close()
-	}
 }
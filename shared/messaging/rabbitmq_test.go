@@ -0,0 +1,42 @@
+package messaging
+
+import (
+	"slices"
+	"testing"
+)
+
+// Every routing key with a schema is published by a service, the broker returns it if no queue is bound for it
+func TestEveryPublishedRoutingKeyIsBound(t *testing.T) {
+	bound := make(map[string]bool)
+	for _, binding := range tripQueueBindings {
+		for _, key := range binding.routingKeys {
+			bound[key] = true
+		}
+	}
+
+	var keys []string
+	for key := range schemaVersions {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if !bound[key] {
+			t.Errorf("no queue is bound for %s, add it to tripQueueBindings", key)
+		}
+	}
+}
+
+func TestTripQueueBindingsAreDeclaredOnce(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, binding := range tripQueueBindings {
+		if seen[binding.queue] {
+			t.Errorf("queue %s is declared twice", binding.queue)
+		}
+		seen[binding.queue] = true
+
+		if len(binding.routingKeys) == 0 {
+			t.Errorf("queue %s has no routing key", binding.queue)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers describing why a message failed. They are set on the retried and dead-lettered copies.
+const (
+	HeaderRetryCount         = "x-retry-count"
+	HeaderDeathReason        = "x-death-reason"
+	HeaderOriginExchange     = "x-origin-exchange"
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	HeaderOriginQueue        = "x-origin-queue"
+	HeaderFailedAt           = "x-failed-at"
+)
+
+// RetryDelays are the delay tiers of a failing message: the nth retry waits RetryDelays[n-1] in a retry
+// queue before going back to its queue. A message fails len(RetryDelays)+1 times before the dead letter queue.
+// Set it before NewRabbitMQ, the retry queues are declared from it.
+var RetryDelays = []time.Duration{
+	1 * time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// retryQueueName names the retry queue after its delay, so changing a delay declares a new queue
+// rather than conflicting with the TTL of the existing one
+func retryQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queueName, delay.Milliseconds())
+}
+
+// declareRetryQueues declares a queue per delay tier. Messages expire from it back to the original queue
+// through the default exchange, which routes on the queue name.
+func declareRetryQueues(ch *amqp.Channel, queueName string) error {
+	for _, delay := range RetryDelays {
+		if _, err := ch.QueueDeclare(
+			retryQueueName(queueName, delay),
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queueName,
+			},
+		); err != nil {
+			return fmt.Errorf("failed to declare the %v retry queue of %s: %v", delay, queueName, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreRouting gives a retried message back the exchange and routing key it was first published with,
+// since it comes back from its retry queue through the default exchange
+func restoreRouting(d *amqp.Delivery) {
+	if key, ok := d.Headers[HeaderOriginalRoutingKey].(string); ok {
+		d.RoutingKey = key
+	}
+	if exchange, ok := d.Headers[HeaderOriginExchange].(string); ok {
+		d.Exchange = exchange
+	}
+}
+
+// retryCount returns how many times the message was already retried
+func retryCount(headers amqp.Table) int {
+	switch n := headers[HeaderRetryCount].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// retryLater publishes a copy of the failed message to its next retry queue, or to the dead letter exchange
+// once every tier was used, then acks the original. If the copy can't be published the original is
+// rejected, to the dead letter queue.
+func (r *RabbitMQ) retryLater(ctx context.Context, queueName string, d amqp.Delivery, cause error) {
+	retries := retryCount(d.Headers)
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+
+	headers[HeaderDeathReason] = cause.Error()
+	headers[HeaderOriginExchange] = d.Exchange
+	headers[HeaderOriginalRoutingKey] = d.RoutingKey
+	headers[HeaderOriginQueue] = queueName
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	exchange, routingKey := DeadLetterExchange, d.RoutingKey
+	if retries < len(RetryDelays) {
+		exchange, routingKey = "", retryQueueName(queueName, RetryDelays[retries])
+		headers[HeaderRetryCount] = int32(retries + 1)
+		log.Printf("Message %s from %s failed, retry %d/%d in %v: %v",
+			d.MessageId, queueName, retries+1, len(RetryDelays), RetryDelays[retries], cause)
+	} else {
+		log.Printf("Message %s from %s failed after %d retries, moving it to the dead letter queue: %v",
+			d.MessageId, queueName, retries, cause)
+	}
+
+	err := r.publish(ctx, exchange, routingKey, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		Type:          d.Type,
+		AppId:         d.AppId,
+		Body:          d.Body,
+	})
+	if err != nil {
+		// Requeuing would hand the message straight back to the consumer, it is dead-lettered by the queue instead
+		log.Printf("ERROR: Failed to schedule the retry of message %s, dead-lettering it: %v", d.MessageId, err)
+		_ = d.Nack(false, false)
+		return
+	}
+
+	if err := d.Ack(false); err != nil {
+		log.Printf("ERROR: Failed to Ack message: %v. Message body: %s", err, d.Body)
+	}
+}
@@ -0,0 +1,142 @@
+package messaging
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// returnedMessages counts the messages the broker could not route to any queue.
+// It going up usually means a binding is missing in setupExchangesAndQueues.
+//
+// The services only register a tracer provider (see tracing.InitTracer), not a meter provider: until
+// one is, the counter is a no-op and the warning logged by handleReturn is the only report.
+var returnedMessages, _ = otel.Meter("rabbitmq").Int64Counter(
+	"rabbitmq.messages.returned",
+	metric.WithDescription("Messages published as mandatory that no queue was bound for"),
+)
+
+// returnWatches are the published messages whose publisher waits to know if the broker returned them,
+// by message ID, see publishUnlessReturned
+type returnWatches struct {
+	mu      sync.Mutex
+	watches map[string]chan struct{}
+}
+
+// watch starts watching for the return of the message, until the returned function is called
+func (w *returnWatches) watch(messageID string) (<-chan struct{}, func()) {
+	returned := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	if w.watches == nil {
+		w.watches = make(map[string]chan struct{})
+	}
+	w.watches[messageID] = returned
+	w.mu.Unlock()
+
+	return returned, func() {
+		w.mu.Lock()
+		delete(w.watches, messageID)
+		w.mu.Unlock()
+	}
+}
+
+// notify tells the publisher of the message it was returned, it reports whether one was watching
+func (w *returnWatches) notify(messageID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	returned, ok := w.watches[messageID]
+	if ok {
+		select {
+		case returned <- struct{}{}:
+		default:
+		}
+	}
+	return ok
+}
+
+// confirmTracker follows the confirms of a channel on the goroutine handling its returns, see trackPublishes
+type confirmTracker struct {
+	mu        sync.Mutex
+	changed   *sync.Cond
+	confirmed uint64 // delivery tag of the last confirm, they are handed over in order
+	closed    bool
+}
+
+func newConfirmTracker() *confirmTracker {
+	t := &confirmTracker{}
+	t.changed = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *confirmTracker) confirm(deliveryTag uint64) {
+	t.mu.Lock()
+	t.confirmed = max(t.confirmed, deliveryTag)
+	t.mu.Unlock()
+	t.changed.Broadcast()
+}
+
+func (t *confirmTracker) close() {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.changed.Broadcast()
+}
+
+// waitFor blocks until the confirm of the delivery tag went through the tracker. It returns false if the
+// channel closed first.
+func (t *confirmTracker) waitFor(deliveryTag uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for t.confirmed < deliveryTag && !t.closed {
+		t.changed.Wait()
+	}
+	return t.confirmed >= deliveryTag
+}
+
+// trackPublishes handles the returns and the confirms of a channel until it is closed. The broker returns
+// an unroutable message before acking it, and amqp091 hands both over in that order on the same goroutine,
+// blocking on these unbuffered channels: the confirm of a message only reaches the tracker once its return
+// was handled. The publisher's own confirmation is resolved earlier, see publishUnlessReturned.
+func (r *RabbitMQ) trackPublishes(returns <-chan amqp.Return, confirms <-chan amqp.Confirmation, tracker *confirmTracker) {
+	for returns != nil || confirms != nil {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			r.handleReturn(ret)
+		case c, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			tracker.confirm(c.DeliveryTag)
+		}
+	}
+
+	tracker.close()
+}
+
+// handleReturn reports an unroutable message, unless its publisher watches for its return
+func (r *RabbitMQ) handleReturn(ret amqp.Return) {
+	if ret.MessageId != "" && r.returns.notify(ret.MessageId) {
+		return
+	}
+
+	log.Printf("WARNING: unroutable message returned by the broker: exchange=%s routing key=%s reply=%d %s",
+		ret.Exchange, ret.RoutingKey, ret.ReplyCode, ret.ReplyText)
+
+	returnedMessages.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("messaging.destination", ret.Exchange),
+		attribute.String("messaging.routing_key", ret.RoutingKey),
+	))
+}
@@ -0,0 +1,93 @@
+package messaging
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestAwaitReturn(t *testing.T) {
+	const messageID = "message-1"
+
+	tests := []struct {
+		name    string
+		returns []string // message IDs returned before the confirm of delivery tag 1
+		confirm bool     // the confirm is handed over, otherwise the channel closes
+		wantErr error
+	}{
+		{"routed message", nil, true, nil},
+		{"returned message", []string{messageID}, true, ErrMessageReturned},
+		{"another message returned", []string{"message-2"}, true, nil},
+		{"channel closed before the confirm", nil, false, ErrNotConnected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RabbitMQ{}
+			tracker := newConfirmTracker()
+			returns := make(chan amqp.Return)
+			confirms := make(chan amqp.Confirmation)
+
+			tracked := make(chan struct{})
+			go func() {
+				r.trackPublishes(returns, confirms, tracker)
+				close(tracked)
+			}()
+
+			returned, unwatch := r.returns.watch(messageID)
+			defer unwatch()
+
+			// The publisher checks for the return as soon as its confirmation is resolved, which amqp091
+			// does before handing the return and the confirm to the tracker
+			result := make(chan error, 1)
+			go func() {
+				result <- awaitReturn(tracker, 1, returned, "gateway.instance-1")
+			}()
+
+			// Hand them over in the order of amqp091, on unbuffered channels
+			for _, id := range tt.returns {
+				returns <- amqp.Return{MessageId: id, RoutingKey: "gateway.instance-1"}
+			}
+			if tt.confirm {
+				confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+			} else {
+				close(returns)
+				close(confirms)
+			}
+
+			select {
+			case err := <-result:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("awaitReturn() = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("awaitReturn() did not return")
+			}
+
+			if tt.confirm {
+				close(returns)
+				close(confirms)
+			}
+			<-tracked
+		})
+	}
+}
+
+func TestConfirmTrackerWaitFor(t *testing.T) {
+	tracker := newConfirmTracker()
+
+	// Confirms come in order, a later one covers the earlier tags
+	tracker.confirm(3)
+	for _, tag := range []uint64{1, 2, 3} {
+		if !tracker.waitFor(tag) {
+			t.Errorf("waitFor(%d) = false after the confirm of 3", tag)
+		}
+	}
+
+	tracker.close()
+	if tracker.waitFor(4) {
+		t.Error("waitFor(4) = true after the channel closed")
+	}
+}
@@ -0,0 +1,42 @@
+package messaging
+
+import (
+	"ride-sharing/shared/contracts"
+	pbd "ride-sharing/shared/proto/driver"
+)
+
+// The payload of every routing key. A breaking change registers a new type under the next version,
+// and the old one stays registered until no service publishes it anymore.
+func init() {
+	for _, key := range []string{
+		contracts.TripEventCreated,
+		contracts.TripEventDriverAssigned,
+		contracts.TripEventNoDriversFound,
+		contracts.TripEventDriverNotInterested,
+		contracts.TripEventDriverArrived,
+		contracts.TripEventStarted,
+		contracts.TripEventCompleted,
+		contracts.TripEventPaid,
+		contracts.TripEventCancelled,
+		contracts.TripEventExpired,
+		contracts.DriverCmdTripRequest,
+	} {
+		RegisterSchema[TripEventData](key, 1)
+	}
+
+	// The assigned driver, as a list so the rider map can draw it like the nearby drivers
+	RegisterSchema[[]*pbd.Driver](contracts.TripEventDriverLocation, 1)
+
+	RegisterSchema[DriverTripResponseData](contracts.DriverCmdTripAccept, 1)
+	RegisterSchema[DriverTripResponseData](contracts.DriverCmdTripDecline, 1)
+
+	RegisterSchema[DriverTripProgressData](contracts.DriverCmdArrived, 1)
+	RegisterSchema[DriverTripProgressData](contracts.DriverCmdTripStart, 1)
+	RegisterSchema[DriverTripProgressData](contracts.DriverCmdTripComplete, 1)
+
+	RegisterSchema[DriverLocationData](contracts.DriverCmdLocation, 1)
+
+	RegisterSchema[PaymentTripResponseData](contracts.PaymentCmdCreateSession, 1)
+	RegisterSchema[PaymentEventSessionCreatedData](contracts.PaymentEventSessionCreated, 1)
+	RegisterSchema[PaymentStatusUpdateData](contracts.PaymentEventSuccess, 1)
+}
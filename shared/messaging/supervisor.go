@@ -0,0 +1,194 @@
+package messaging
+
+import (
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	reconnectInitialWait = 1 * time.Second
+	reconnectMaxWait     = 30 * time.Second
+)
+
+// consumer is a queue subscription, started on the current channel and on every one after it
+type consumer struct {
+	queue  string
+	handle func(msg amqp.Delivery)
+	// declare creates the queues that don't outlive the connection, before every start
+	declare func(ch *amqp.Channel) error
+}
+
+// subscribe registers the consumer and starts it right away if the broker is reachable
+func (r *RabbitMQ) subscribe(c *consumer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.consumers = append(r.consumers, c)
+
+	if !r.ready {
+		// Started by the supervisor once it reconnects
+		return nil
+	}
+
+	return startConsumer(r.channel, c)
+}
+
+// startConsumer handles the deliveries until the channel closes
+func startConsumer(ch *amqp.Channel, c *consumer) error {
+	if c.declare != nil {
+		if err := c.declare(ch); err != nil {
+			return err
+		}
+	}
+
+	msgs, err := ch.Consume(
+		c.queue, // queue
+		"",      // consumer
+		false,   // auto-ack
+		false,   // exclusive
+		false,   // no-local
+		false,   // no-wait
+		nil,     // args
+	)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for msg := range msgs {
+			c.handle(msg)
+		}
+	}()
+
+	return nil
+}
+
+// Ready reports whether the broker is reachable and the consumers are running
+func (r *RabbitMQ) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.ready
+}
+
+// OnReadinessChange calls fn with the current readiness, and again every time it changes
+func (r *RabbitMQ) OnReadinessChange(fn func(ready bool)) {
+	r.mu.Lock()
+	r.readinessHandlers = append(r.readinessHandlers, fn)
+	ready := r.ready
+	r.mu.Unlock()
+
+	fn(ready)
+}
+
+// readyChannel returns the channel to publish on, or nil while reconnecting
+func (r *RabbitMQ) readyChannel() *amqp.Channel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.ready {
+		return nil
+	}
+	return r.channel
+}
+
+// supervise waits for the connection or its channel to close, then reconnects with backoff,
+// declares the topology again and restarts the consumers. It returns once Close is called.
+func (r *RabbitMQ) supervise(conn *amqp.Connection, ch *amqp.Channel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+
+		if r.isClosed() {
+			return
+		}
+
+		log.Printf("RabbitMQ connection lost: %v", reason)
+		r.setReady(false)
+
+		// A channel error leaves the connection open, start over from a new one
+		conn.Close()
+
+		var ok bool
+		conn, ch, ok = r.reconnect()
+		if !ok {
+			return
+		}
+
+		log.Println("RabbitMQ connection restored")
+		r.setReady(true)
+	}
+}
+
+// reconnect retries until the connection is back with every consumer running, or until Close is called
+func (r *RabbitMQ) reconnect() (*amqp.Connection, *amqp.Channel, bool) {
+	wait := reconnectInitialWait
+
+	for {
+		time.Sleep(wait)
+
+		if r.isClosed() {
+			return nil, nil, false
+		}
+
+		conn, ch, err := r.connect()
+		if err == nil {
+			if err = r.restartConsumers(conn, ch); err == nil {
+				return conn, ch, true
+			}
+			conn.Close()
+		}
+
+		log.Printf("Failed to reconnect to RabbitMQ, retrying in %v: %v", wait, err)
+
+		wait *= 2
+		if wait > reconnectMaxWait {
+			wait = reconnectMaxWait
+		}
+	}
+}
+
+// restartConsumers starts every registered consumer on the new channel and makes it the current one
+func (r *RabbitMQ) restartConsumers(conn *amqp.Connection, ch *amqp.Channel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.consumers {
+		if err := startConsumer(ch, c); err != nil {
+			return err
+		}
+	}
+
+	// Consumers subscribing from now on start right away rather than waiting for a restart
+	r.conn = conn
+	r.channel = ch
+	r.ready = true
+
+	return nil
+}
+
+func (r *RabbitMQ) setReady(ready bool) {
+	r.mu.Lock()
+	r.ready = ready
+	handlers := r.readinessHandlers
+	r.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(ready)
+	}
+}
+
+func (r *RabbitMQ) isClosed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.closed
+}
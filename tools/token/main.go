@@ -0,0 +1,66 @@
+// Command token signs an HS256 token for local development, with the secret the gateway verifies.
+//
+//	go run ./tools/token -sub rider-1 -role rider
+//	go run ./tools/token -sub driver-1 -role driver -ttl 24h
+//
+// The secret is read from JWT_HS256_SECRET. The token is printed on stdout, pass it as a bearer token
+// or as the token query parameter of the WebSocket endpoints.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"ride-sharing/shared/auth"
+	"ride-sharing/shared/env"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	sub := flag.String("sub", "", "user ID the token is issued for")
+	role := flag.String("role", string(auth.RoleRider), "role of the user: rider, driver or admin")
+	ttl := flag.Duration("ttl", 12*time.Hour, "lifetime of the token")
+	issuer := flag.String("iss", env.GetString("JWT_ISSUER", ""), "issuer, when the gateway checks it")
+	audience := flag.String("aud", env.GetString("JWT_AUDIENCE", ""), "audience, when the gateway checks it")
+	flag.Parse()
+
+	secret := env.GetString("JWT_HS256_SECRET", "")
+	if secret == "" {
+		log.Fatal("JWT_HS256_SECRET is required")
+	}
+
+	if *sub == "" {
+		log.Fatal("-sub is required")
+	}
+
+	if !auth.Role(*role).IsValid() {
+		log.Fatalf("unknown role %q", *role)
+	}
+
+	now := time.Now()
+	claims := auth.Claims{
+		Role: auth.Role(*role),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   *sub,
+			Issuer:    *issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(*ttl)),
+		},
+	}
+	if *audience != "" {
+		claims.Audience = jwt.ClaimStrings{*audience}
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		log.Fatalf("failed to sign the token: %v", err)
+	}
+
+	fmt.Fprintln(os.Stdout, token)
+}
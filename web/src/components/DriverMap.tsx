@@ -12,6 +12,8 @@ import * as Geohash from 'ngeohash';
 import { RoutingControl } from "./RoutingControl";
 import { DriverCard } from "./DriverCard";
 import { TripEvents } from "../contracts";
+import { DRIVER_TOKEN } from "../constants";
+import { userIDFromToken } from "../utils/auth";
 
 const START_LOCATION: Coordinate = {
   latitude: 37.7749,
@@ -38,7 +40,8 @@ const destinationMarker = new L.Icon({
 
 export const DriverMap = ({ packageSlug }: { packageSlug: CarPackageSlug }) => {
   const mapRef = useRef<L.Map>(null)
-  const userID = useMemo(() => crypto.randomUUID(), [])
+  const tripStartedAt = useRef<number | null>(null)
+  const userID = useMemo(() => userIDFromToken(DRIVER_TOKEN), [])
   const [riderLocation, setRiderLocation] = useState<Coordinate>(START_LOCATION)
 
   const driverGeohash = useMemo(() =>
@@ -57,6 +60,7 @@ export const DriverMap = ({ packageSlug }: { packageSlug: CarPackageSlug }) => {
     location: riderLocation,
     geohash: driverGeohash,
     userID,
+    token: DRIVER_TOKEN,
     packageSlug,
   })
 
@@ -105,6 +109,37 @@ export const DriverMap = ({ packageSlug }: { packageSlug: CarPackageSlug }) => {
     resetTripStatus()
   }
 
+  const handleTripProgress = (type: TripEvents.DriverArrive | TripEvents.DriverTripStart | TripEvents.DriverTripComplete) => {
+    if (!requestedTrip || !requestedTrip.id) {
+      alert("No trip ID found")
+      return
+    }
+
+    if (type === TripEvents.DriverTripStart) {
+      tripStartedAt.current = Date.now()
+    }
+
+    // The demo driver doesn't drive the route: it reports the quoted distance and the time spent on the trip
+    const completion = type === TripEvents.DriverTripComplete ? {
+      distance: requestedTrip.route?.distance,
+      duration: tripStartedAt.current ? Math.round((Date.now() - tripStartedAt.current) / 1000) : undefined,
+    } : {}
+
+    sendMessage({
+      type,
+      data: {
+        tripID: requestedTrip.id,
+        ...completion,
+      }
+    })
+
+    setTripStatus(type)
+
+    if (type === TripEvents.DriverTripComplete) {
+      tripStartedAt.current = null
+    }
+  }
+
   console.log({ requestedTrip })
 
   const parsedRoute = useMemo(() =>
@@ -182,6 +217,10 @@ export const DriverMap = ({ packageSlug }: { packageSlug: CarPackageSlug }) => {
             status={tripStatus}
             onAcceptTrip={handleAcceptTrip}
             onDeclineTrip={handleDeclineTrip}
+            onArrive={() => handleTripProgress(TripEvents.DriverArrive)}
+            onStartTrip={() => handleTripProgress(TripEvents.DriverTripStart)}
+            onCompleteTrip={() => handleTripProgress(TripEvents.DriverTripComplete)}
+            onDone={resetTripStatus}
           />
         </div>
       </div>
@@ -7,10 +7,14 @@ interface DriverTripOverviewProps {
   trip?: Trip | null,
   status?: TripEvents | null,
   onAcceptTrip?: () => void,
-  onDeclineTrip?: () => void
+  onDeclineTrip?: () => void,
+  onArrive?: () => void,
+  onStartTrip?: () => void,
+  onCompleteTrip?: () => void,
+  onDone?: () => void,
 }
 
-export const DriverTripOverview = ({ trip, status, onAcceptTrip, onDeclineTrip }: DriverTripOverviewProps) => {
+export const DriverTripOverview = ({ trip, status, onAcceptTrip, onDeclineTrip, onArrive, onStartTrip, onCompleteTrip, onDone }: DriverTripOverviewProps) => {
   if (!trip) {
     return (
       <TripOverviewCard
@@ -38,7 +42,7 @@ export const DriverTripOverview = ({ trip, status, onAcceptTrip, onDeclineTrip }
     return (
       <TripOverviewCard
         title="All set!"
-        description="You can now start the trip"
+        description="Drive to the pickup and let the rider know when you are there"
       >
         <div className="flex flex-col gap-4">
           <div className="flex flex-col gap-2">
@@ -49,10 +53,44 @@ export const DriverTripOverview = ({ trip, status, onAcceptTrip, onDeclineTrip }
               Rider ID: {trip.userID}
             </p>
           </div>
+          <Button onClick={onArrive}>I have arrived</Button>
         </div>
       </TripOverviewCard>
     )
   }
 
+  if (status === TripEvents.DriverArrive) {
+    return (
+      <TripOverviewCard
+        title="At the pickup"
+        description="Start the trip once the rider is on board"
+      >
+        <Button onClick={onStartTrip}>Start trip</Button>
+      </TripOverviewCard>
+    )
+  }
+
+  if (status === TripEvents.DriverTripStart) {
+    return (
+      <TripOverviewCard
+        title="Trip in progress"
+        description="Complete the trip at the destination, the rider is then asked to pay"
+      >
+        <Button onClick={onCompleteTrip}>Complete trip</Button>
+      </TripOverviewCard>
+    )
+  }
+
+  if (status === TripEvents.DriverTripComplete) {
+    return (
+      <TripOverviewCard
+        title="Trip completed!"
+        description="The rider has been asked to pay for the trip"
+      >
+        <Button variant="outline" onClick={onDone}>Wait for the next trip</Button>
+      </TripOverviewCard>
+    )
+  }
+
   return null
 }
\ No newline at end of file
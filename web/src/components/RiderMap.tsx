@@ -10,7 +10,8 @@ import { MapClickHandler } from './MapClickHandler';
 import { Button } from './ui/button';
 import { RouteFare, RequestRideProps, TripPreview, HTTPTripStartResponse } from "../types";
 import { RoutingControl } from "./RoutingControl";
-import { API_URL } from '../constants';
+import { API_URL, RIDER_TOKEN } from '../constants';
+import { authHeaders, userIDFromToken } from '../utils/auth';
 import { RiderTripOverview } from './RiderTripOverview';
 import { BackendEndpoints, HTTPTripPreviewRequestPayload, HTTPTripPreviewResponse, HTTPTripStartRequestPayload } from '../contracts';
 
@@ -35,7 +36,7 @@ export default function RiderMap({ onRouteSelected }: RiderMapProps) {
     const [selectedCarPackage] = useState<RouteFare | null>(null)
     const [destination, setDestination] = useState<[number, number] | null>(null)
     const mapRef = useRef<L.Map>(null)
-    const userID = useMemo(() => crypto.randomUUID(), [])
+    const userID = useMemo(() => userIDFromToken(RIDER_TOKEN), [])
     const debounceTimeoutRef = useRef<NodeJS.Timeout | null>(null);
 
     const location = {
@@ -50,7 +51,7 @@ export default function RiderMap({ onRouteSelected }: RiderMapProps) {
         assignedDriver,
         paymentSession,
         resetTripStatus
-    } = useRiderStreamConnection(location, userID);
+    } = useRiderStreamConnection(location, userID, RIDER_TOKEN);
 
     console.log(tripStatus)
 
@@ -91,7 +92,6 @@ export default function RiderMap({ onRouteSelected }: RiderMapProps) {
     const requestRidePreview = async (props: RequestRideProps): Promise<HTTPTripPreviewResponse> => {
         const { pickup, destination } = props
         const payload = {
-            userID: userID,
             pickup: {
                 latitude: pickup[0],
                 longitude: pickup[1],
@@ -104,6 +104,7 @@ export default function RiderMap({ onRouteSelected }: RiderMapProps) {
 
         const response = await fetch(`${API_URL}${BackendEndpoints.PREVIEW_TRIP}`, {
             method: 'POST',
+            headers: authHeaders(RIDER_TOKEN),
             body: JSON.stringify(payload),
         })
         const { data } = await response.json() as { data: HTTPTripPreviewResponse }
@@ -113,7 +114,6 @@ export default function RiderMap({ onRouteSelected }: RiderMapProps) {
     const handleStartTrip = async (fare: RouteFare) => {
         const payload = {
             rideFareID: fare.id,
-            userID: userID,
         } as HTTPTripStartRequestPayload
 
         if (!fare.id) {
@@ -123,6 +123,8 @@ export default function RiderMap({ onRouteSelected }: RiderMapProps) {
 
         const response = await fetch(`${API_URL}${BackendEndpoints.START_TRIP}`, {
             method: 'POST',
+            // A fare can only be booked once, so it also identifies retries of this request
+            headers: { ...authHeaders(RIDER_TOKEN), 'Idempotency-Key': fare.id },
             body: JSON.stringify(payload),
         })
         const data = await response.json() as HTTPTripStartResponse
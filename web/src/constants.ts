@@ -1,2 +1,6 @@
 export const API_URL = process.env.NEXT_PUBLIC_API_URL ?? 'http://localhost:8081';
 export const WEBSOCKET_URL = process.env.NEXT_PUBLIC_WEBSOCKET_URL ?? 'ws://localhost:8081/ws';
+
+// Development tokens, signed with `go run ./tools/token`: the gateway takes the user from them
+export const RIDER_TOKEN = process.env.NEXT_PUBLIC_RIDER_TOKEN ?? '';
+export const DRIVER_TOKEN = process.env.NEXT_PUBLIC_DRIVER_TOKEN ?? '';
@@ -1,4 +1,4 @@
-import { Coordinate, Driver, Route, RouteFare, Trip } from "./types";
+import { Coordinate, Driver, DriverStatus, Route, RouteFare, Trip } from "./types";
 
 // These are the endpoints the API Gateway must have for the frontend to work correctly
 export enum BackendEndpoints {
@@ -11,29 +11,40 @@ export enum BackendEndpoints {
 export enum TripEvents {
   NoDriversFound = "trip.event.no_drivers_found",
   DriverAssigned = "trip.event.driver_assigned",
+  DriverArrived = "trip.event.driver_arrived",
+  Started = "trip.event.started",
   Completed = "trip.event.completed",
+  Paid = "trip.event.paid",
+  Expired = "trip.event.expired",
   Cancelled = "trip.event.cancelled",
   Created = "trip.event.created",
   DriverLocation = "driver.cmd.location",
   DriverTripRequest = "driver.cmd.trip_request",
   DriverTripAccept = "driver.cmd.trip_accept",
   DriverTripDecline = "driver.cmd.trip_decline",
+  DriverTripCancel = "driver.cmd.trip_cancel",
+  DriverArrive = "driver.cmd.arrived",
+  DriverTripStart = "driver.cmd.trip_start",
+  DriverTripComplete = "driver.cmd.trip_complete",
   DriverRegister = "driver.cmd.register",
+  DriverSetStatus = "driver.cmd.set_status",
   PaymentSessionCreated = "payment.event.session_created",
 }
 
-// Messages sent from the server to the client via the websocket
-export type ServerWsMessage =
+// Messages sent from the server to the client via the websocket. The ones kept for offline users are numbered.
+export type ServerWsMessage = (
   | PaymentSessionCreatedRequest
   | DriverAssignedRequest
   | DriverLocationRequest
   | DriverTripRequest
   | DriverRegisterRequest
+  | DriverStatusChangedRequest
   | TripCreatedRequest
-  | NoDriversFoundRequest;
+  | NoDriversFoundRequest
+) & { seq?: number };
 
 // Messages sent from the client to the server via the websocket
-export type ClientWsMessage = DriverResponseToTripResponse
+export type ClientWsMessage = DriverResponseToTripResponse | DriverTripProgressResponse | DriverSetStatusResponse
 
 interface TripCreatedRequest {
   type: TripEvents.Created;
@@ -48,6 +59,10 @@ interface DriverRegisterRequest {
   type: TripEvents.DriverRegister;
   data: Driver;
 }
+interface DriverStatusChangedRequest {
+  type: TripEvents.DriverSetStatus;
+  data: Driver;
+}
 interface DriverTripRequest {
   type: TripEvents.DriverTripRequest;
   data: Trip;
@@ -84,6 +99,22 @@ interface DriverResponseToTripResponse {
   };
 }
 
+interface DriverTripProgressResponse {
+  type: TripEvents.DriverArrive | TripEvents.DriverTripStart | TripEvents.DriverTripComplete;
+  data: {
+    tripID: string;
+    distance?: number; // meters driven, on completion
+    duration?: number; // seconds driven, on completion
+  };
+}
+
+interface DriverSetStatusResponse {
+  type: TripEvents.DriverSetStatus;
+  data: {
+    status: DriverStatus;
+  };
+}
+
 export interface HTTPTripPreviewResponse {
   route: Route;
   rideFares: RouteFare[];
@@ -91,11 +122,9 @@ export interface HTTPTripPreviewResponse {
 
 export interface HTTPTripStartRequestPayload {
   rideFareID: string;
-  userID: string;
 }
 
 export interface HTTPTripPreviewRequestPayload {
-  userID: string;
   pickup: Coordinate;
   destination: Coordinate;
 }
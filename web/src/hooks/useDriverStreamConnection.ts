@@ -2,6 +2,7 @@ import { useEffect, useState } from 'react';
 import { WEBSOCKET_URL } from "../constants";
 import { Trip, Driver, CarPackageSlug } from '../types';
 import { ServerWsMessage, TripEvents, isValidWsMessage, isValidTripEvent, ClientWsMessage, BackendEndpoints } from '../contracts';
+import { acceptSeq, getLastSeq } from '../utils/sequence';
 
 interface useDriverConnectionProps {
   location: {
@@ -10,6 +11,7 @@ interface useDriverConnectionProps {
   };
   geohash: string;
   userID: string;
+  token: string;
   packageSlug: CarPackageSlug;
 }
 
@@ -17,6 +19,7 @@ export const useDriverStreamConnection = ({
   location,
   geohash,
   userID,
+  token,
   packageSlug
 }: useDriverConnectionProps) => {
   const [requestedTrip, setRequestedTrip] = useState<Trip | null>(null)
@@ -28,7 +31,8 @@ export const useDriverStreamConnection = ({
   useEffect(() => {
     if (!userID) return;
 
-    const websocket = new WebSocket(`${WEBSOCKET_URL}${BackendEndpoints.WS_DRIVERS}?userID=${userID}&packageSlug=${packageSlug}`);
+    // Browsers can't set headers on a WebSocket, the token goes in the query
+    const websocket = new WebSocket(`${WEBSOCKET_URL}${BackendEndpoints.WS_DRIVERS}?token=${encodeURIComponent(token)}&packageSlug=${packageSlug}&lastSeq=${getLastSeq(userID)}`);
     setWs(websocket);
 
     websocket.onopen = () => {
@@ -52,6 +56,8 @@ export const useDriverStreamConnection = ({
         return;
       }
 
+      if (!acceptSeq(userID, message.seq)) return;
+
       switch (message.type) {
         case TripEvents.DriverTripRequest:
           const trip = (message.data?.trip) ?? message.data;
@@ -3,8 +3,9 @@ import { WEBSOCKET_URL } from "../constants";
 import { Trip } from '../types';
 import { Driver, Coordinate } from '../types';
 import { PaymentEventSessionCreatedData, TripEvents, ServerWsMessage, isValidWsMessage, BackendEndpoints } from '../contracts';
+import { acceptSeq, getLastSeq } from '../utils/sequence';
 
-export function useRiderStreamConnection(location: Coordinate, userID: string) {
+export function useRiderStreamConnection(location: Coordinate, userID: string, token: string) {
   const [drivers, setDrivers] = useState<Driver[]>([]);
   const [tripStatus, setTripStatus] = useState<TripEvents | null>(null);
   const [paymentSession, setPaymentSession] = useState<PaymentEventSessionCreatedData | null>(null);
@@ -14,7 +15,8 @@ export function useRiderStreamConnection(location: Coordinate, userID: string) {
   useEffect(() => {
     if (!userID) return;
 
-    const ws = new WebSocket(`${WEBSOCKET_URL}${BackendEndpoints.WS_RIDERS}?userID=${userID}`);
+    // Browsers can't set headers on a WebSocket, the token goes in the query
+    const ws = new WebSocket(`${WEBSOCKET_URL}${BackendEndpoints.WS_RIDERS}?token=${encodeURIComponent(token)}&lastSeq=${getLastSeq(userID)}`);
 
     ws.onopen = () => {
       // Send initial location
@@ -36,6 +38,8 @@ export function useRiderStreamConnection(location: Coordinate, userID: string) {
         return;
       }
 
+      if (!acceptSeq(userID, message.seq)) return;
+
       switch (message.type) {
         case TripEvents.DriverLocation:
           setDrivers(message.data);
@@ -45,7 +49,7 @@ export function useRiderStreamConnection(location: Coordinate, userID: string) {
           setTripStatus(message.type);
           break;
         case TripEvents.DriverAssigned:
-          setAssignedDriver(message.data.driver);
+          setAssignedDriver(message.data.trip.driver);
           setTripStatus(message.type);
           break;
         case TripEvents.Created:
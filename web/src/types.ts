@@ -38,6 +38,7 @@ export interface RouteFare {
     packageSlug: CarPackageSlug,
     basePrice: number,
     totalPriceInCents?: number,
+    surgeMultiplier?: number,
     expiresAt: Date,
     route: Route,
 }
@@ -63,4 +64,8 @@ export interface Driver {
     name: string;
     profilePicture: string;
     carPlate: string;
+    vehicle?: string;
+    status?: DriverStatus;
 }
+
+export type DriverStatus = "online" | "offered" | "en_route" | "on_trip" | "offline";
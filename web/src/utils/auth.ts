@@ -0,0 +1,19 @@
+// The gateway identifies the user by the subject of its token, the client reads it to key its own state.
+// The signature is checked by the gateway only.
+
+export function userIDFromToken(token: string): string {
+  const payload = token.split('.')[1];
+  if (!payload) return '';
+
+  try {
+    const json = atob(payload.replace(/-/g, '+').replace(/_/g, '/'));
+    const { sub } = JSON.parse(json) as { sub?: string };
+    return sub ?? '';
+  } catch {
+    return '';
+  }
+}
+
+export function authHeaders(token: string): Record<string, string> {
+  return { Authorization: `Bearer ${token}` };
+}
@@ -0,0 +1,18 @@
+// The server numbers the notifications it keeps for offline users. The last number received is sent back
+// on reconnect, as lastSeq, to get the ones missed meanwhile.
+
+const storageKey = (userID: string) => `ws-last-seq:${userID}`;
+
+export function getLastSeq(userID: string): number {
+  return Number(sessionStorage.getItem(storageKey(userID)) ?? 0);
+}
+
+// acceptSeq records the number of a message and tells whether it is new: a message replayed on reconnect
+// can also have been received live.
+export function acceptSeq(userID: string, seq?: number): boolean {
+  if (!seq) return true;
+  if (seq <= getLastSeq(userID)) return false;
+
+  sessionStorage.setItem(storageKey(userID), String(seq));
+  return true;
+}